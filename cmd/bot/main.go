@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -67,6 +69,12 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Run a subcommand instead of the bot if one is given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:], cfg, database)
+		return
+	}
+
 	// Initialize and start the bot
 	bot, err := internal.NewBot(cfg.BotToken, database, cfg)
 	if err != nil {
@@ -89,3 +97,41 @@ func main() {
 
 	log.Println("Bot stopping...")
 }
+
+// runCommand runs a maintenance subcommand
+func runCommand(args []string, cfg *config.Config, database *db.DB) {
+	switch args[0] {
+	case "auth":
+		// Authorize Google Sheets access and store the OAuth token
+		if err := internal.RunSheetsAuth(cfg.Sheets); err != nil {
+			log.Fatalf("Google Sheets authorization failed: %v", err)
+		}
+
+	case "reconcile":
+		// Compare stored files with the spreadsheet and fix the differences
+		flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only report the differences")
+		flags.Parse(args[1:])
+
+		report, err := internal.RunReconcile(cfg, database, *dryRun)
+		if err != nil {
+			log.Fatalf("Reconciliation failed: %v", err)
+		}
+		fmt.Println(report)
+
+	case "import-org":
+		// Load departments and managers from a CSV file
+		if len(args) < 2 {
+			log.Fatalf("Usage: import-org <file.csv>")
+		}
+
+		report, err := internal.ImportOrgCSV(database, args[1])
+		if err != nil {
+			log.Fatalf("Org structure import failed: %v", err)
+		}
+		fmt.Println(report)
+
+	default:
+		log.Fatalf("Unknown command %q. Available commands: auth, reconcile, import-org", args[0])
+	}
+}
@@ -1,15 +1,192 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 )
 
 // Config stores bot configuration
 type Config struct {
-	BotToken string          `json:"bot_token"`
-	MongoURI string          `json:"mongo_uri"`
-	Admins   map[string]bool `json:"admins"`
+	BotToken string `json:"bot_token"`
+	MongoURI string `json:"mongo_uri"`
+
+	// Telegram user IDs of admins
+	AdminIDs []int64 `json:"admin_ids"`
+
+	// Admins by username, from older configs. Entries are moved to AdminIDs
+	// once the username is resolved to a single registered user.
+	Admins map[string]bool `json:"admins,omitempty"`
+
+	// Roles assigned by Telegram user ID; they override roles set with /setrole
+	Roles map[int64]string `json:"roles,omitempty"`
+
+	RateLimits   map[string]RateLimit `json:"rate_limits,omitempty"`
+	Sheets       SheetsConfig         `json:"sheets"`
+	Reports      ReportsConfig        `json:"reports"`
+	Registration RegistrationConfig   `json:"registration"`
+
+	// User who receives the files of banned users when /ban is given "archive",
+	// and of offboarded users when no manager takes them
+	ArchiveUserID int64 `json:"archive_user_id,omitempty"`
+
+	// Directory for ZIP archives of user files, such as those built on offboarding
+	ExportDir string `json:"export_dir,omitempty"`
+
+	// Address for the expvar metrics endpoint, e.g. "127.0.0.1:9090"; empty disables it
+	MetricsAddr string `json:"metrics_addr,omitempty"`
+
+	// File the config was loaded from
+	Path string `json:"-"`
+
+	// Guards AdminIDs and Admins, which can change while the bot is running
+	mu sync.RWMutex
+}
+
+// RegistrationConfig limits who can register with the bot
+type RegistrationConfig struct {
+	// When set, only whitelisted employees and holders of invite codes can register
+	Restricted bool `json:"restricted"`
+
+	// Phone numbers and employee IDs allowed to register
+	Phones      []string `json:"phones,omitempty"`
+	EmployeeIDs []string `json:"employee_ids,omitempty"`
+
+	// CSV file with the columns phone and employee_id, read on every check
+	WhitelistFile string `json:"whitelist_file,omitempty"`
+
+	// How long an invite code stays valid, in hours
+	InviteTTLHours int `json:"invite_ttl_hours,omitempty"`
+}
+
+// ReportsConfig lists the report sinks used in addition to Google Sheets
+type ReportsConfig struct {
+	// Append-only CSV log; empty disables it
+	CSVFile string `json:"csv_file,omitempty"`
+
+	// Local XLSX workbook; empty disables it
+	XLSXFile string `json:"xlsx_file,omitempty"`
+
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+}
+
+// WebhookConfig describes an HTTP endpoint that receives report events.
+// When Secret is set, requests are signed with HMAC-SHA256.
+type WebhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// SheetsConfig describes the Google Sheets spreadsheet used for the upload log
+type SheetsConfig struct {
+	SpreadsheetID string `json:"spreadsheet_id"`
+
+	// Name of the sheet, or a template with {year}, {month} and {team}
+	// placeholders, e.g. "{team}/{month}"; missing sheets are created
+	SheetName string `json:"sheet_name"`
+
+	// Base URL of the Sheets API; empty uses Google. Meant for local fakes and proxies.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Auth            string        `json:"auth"`
+	CredentialsFile string        `json:"credentials_file"`
+	TokenFile       string        `json:"token_file"`
+	Columns         []SheetColumn `json:"columns"`
+
+	// How often the sheet is reconciled with stored files, in minutes; 0 disables the job
+	ReconcileIntervalMinutes int `json:"reconcile_interval_minutes"`
+
+	// How often the review column is polled for manager decisions, in minutes
+	ReviewPollIntervalMinutes int `json:"review_poll_interval_minutes"`
+
+	// Sheet with upload counts per user and month; empty disables it
+	SummarySheetName string `json:"summary_sheet_name,omitempty"`
+
+	// Sheet listing users with their employment status; empty disables it
+	EmployeesSheetName string `json:"employees_sheet_name,omitempty"`
+
+	// Whether the employees sheet lists phone numbers
+	EmployeesSheetPhones bool `json:"employees_sheet_phones,omitempty"`
+
+	// How often the summary and employees sheets are refreshed, in minutes
+	SummaryIntervalMinutes int `json:"summary_interval_minutes,omitempty"`
+}
+
+// Google Sheets authentication modes
+const (
+	SheetsAuthOAuth          = "oauth"
+	SheetsAuthServiceAccount = "service_account"
+)
+
+// SheetColumn maps a field of a file or user record to a spreadsheet column.
+// Columns are written left to right in the order they are listed.
+type SheetColumn struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// Fields that can be written to spreadsheet columns
+const (
+	SheetFieldFileID    = "file_id"
+	SheetFieldUserID    = "user_id"
+	SheetFieldUsername  = "username"
+	SheetFieldFirstName = "first_name"
+	SheetFieldLastName  = "last_name"
+	SheetFieldPhone     = "phone"
+	SheetFieldFileName  = "file_name"
+	SheetFieldFileType  = "file_type"
+	SheetFieldFileSize  = "file_size"
+	SheetFieldCreatedAt = "created_at"
+	SheetFieldTeam      = "team"
+	SheetFieldStatus    = "status"
+
+	// Profile fields the user fills in with /profile
+	SheetFieldPosition   = "position"
+	SheetFieldEmployeeID = "employee_id"
+	SheetFieldEmail      = "email"
+	SheetFieldDepartment = "department"
+	SheetFieldHireDate   = "hire_date"
+
+	// Filled in by managers in the spreadsheet and read back by the bot
+	SheetFieldReview        = "review"
+	SheetFieldReviewComment = "review_comment"
+)
+
+// RateLimit describes a token bucket: up to Burst actions at once, refilled at PerMinute actions per minute
+type RateLimit struct {
+	Burst     int     `json:"burst"`
+	PerMinute float64 `json:"per_minute"`
+}
+
+// Rate limit classes for user actions
+const (
+	RateLimitUpload  = "upload"
+	RateLimitHeavy   = "heavy"
+	RateLimitCommand = "command"
+)
+
+// defaultRateLimits are used for classes missing from the config file
+var defaultRateLimits = map[string]RateLimit{
+	RateLimitUpload:  {Burst: 5, PerMinute: 10},
+	RateLimitHeavy:   {Burst: 3, PerMinute: 6},
+	RateLimitCommand: {Burst: 10, PerMinute: 30},
+}
+
+// defaultSheetColumns is the column layout used when the config file has none
+var defaultSheetColumns = []SheetColumn{
+	{Header: "ID файла", Field: SheetFieldFileID},
+	{Header: "ID пользователя", Field: SheetFieldUserID},
+	{Header: "Имя пользователя", Field: SheetFieldUsername},
+	{Header: "Имя файла", Field: SheetFieldFileName},
+	{Header: "Тип файла", Field: SheetFieldFileType},
+	{Header: "Размер файла", Field: SheetFieldFileSize},
+	{Header: "Дата и время", Field: SheetFieldCreatedAt},
+	{Header: "Статус", Field: SheetFieldStatus},
 }
 
 // LoadConfig loads configuration from JSON file
@@ -23,31 +200,263 @@ func LoadConfig(path string) (*Config, error) {
 	if err := json.Unmarshal(file, &config); err != nil {
 		return nil, err
 	}
+	config.Path = path
 
 	// Initialize admins map if it's nil
 	if config.Admins == nil {
 		config.Admins = make(map[string]bool)
 	}
 
+	// Fill in default rate limits
+	if config.RateLimits == nil {
+		config.RateLimits = make(map[string]RateLimit)
+	}
+	for class, limit := range defaultRateLimits {
+		if _, ok := config.RateLimits[class]; !ok {
+			config.RateLimits[class] = limit
+		}
+	}
+
+	// A negative interval would make the ticker of the job panic
+	intervals := []struct {
+		key     string
+		minutes int
+	}{
+		{"reconcile_interval_minutes", config.Sheets.ReconcileIntervalMinutes},
+		{"review_poll_interval_minutes", config.Sheets.ReviewPollIntervalMinutes},
+		{"summary_interval_minutes", config.Sheets.SummaryIntervalMinutes},
+	}
+	for _, interval := range intervals {
+		if interval.minutes < 0 {
+			return nil, fmt.Errorf("sheets.%s must not be negative, got %d", interval.key, interval.minutes)
+		}
+	}
+
+	// Fill in Google Sheets defaults
+	if config.Sheets.SheetName == "" {
+		config.Sheets.SheetName = "Лист1"
+	}
+	if config.Sheets.Auth == "" {
+		config.Sheets.Auth = SheetsAuthOAuth
+	}
+	if config.Sheets.CredentialsFile == "" {
+		config.Sheets.CredentialsFile = "config/credentials.json"
+	}
+	if config.Sheets.TokenFile == "" {
+		config.Sheets.TokenFile = "config/token.json"
+	}
+	if config.Sheets.ReviewPollIntervalMinutes == 0 {
+		config.Sheets.ReviewPollIntervalMinutes = 1
+	}
+	if config.Sheets.SummaryIntervalMinutes == 0 {
+		config.Sheets.SummaryIntervalMinutes = 60
+	}
+	if config.ExportDir == "" {
+		config.ExportDir = "exports"
+	}
+	if config.Registration.InviteTTLHours == 0 {
+		config.Registration.InviteTTLHours = 7 * 24
+	}
+	if len(config.Sheets.Columns) == 0 {
+		config.Sheets.Columns = append([]SheetColumn(nil), defaultSheetColumns...)
+	}
+
 	return &config, nil
 }
 
-// SaveConfig saves configuration to JSON file
+// SaveConfig writes the admin lists, which change while the bot is running, to the
+// JSON file. Only admin_ids and admins are replaced: other settings stay as written in
+// the file, so defaults filled in by LoadConfig never end up there. The file is written
+// next to the old one and then renamed over it, so a crash never leaves a truncated config.
 func SaveConfig(config *Config, path string) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	config.mu.RLock()
+	adminIDs, err := json.Marshal(append([]int64{}, config.AdminIDs...))
+	var admins []byte
+	if err == nil && len(config.Admins) > 0 {
+		admins, err = json.Marshal(config.Admins)
+	}
+	config.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	doc, err := parseJSONObject(current)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	doc.set("admin_ids", adminIDs)
+	if admins != nil {
+		doc.set("admins", admins)
+	} else {
+		doc.remove("admins")
+	}
+	data, err := doc.marshal()
+	if err != nil {
+		return err
+	}
+
+	// Keep the permissions of the existing file, it holds the bot token
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name())
 
-	return os.WriteFile(path, data, 0644)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
-// IsAdmin checks if the username is in the admins list
-func (c *Config) IsAdmin(username string) bool {
-	return c.Admins[username]
+// IsAdmin checks if the user ID is in the admins list
+func (c *Config) IsAdmin(userID int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Contains(c.AdminIDs, userID)
 }
 
-// SetAdmin adds a username to the admin list
-func (c *Config) SetAdmin(username string, isAdmin bool) {
-	c.Admins[username] = isAdmin
+// SetAdmin adds a user ID to the admin list or removes it
+func (c *Config) SetAdmin(userID int64, isAdmin bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.AdminIDs = slices.DeleteFunc(c.AdminIDs, func(id int64) bool { return id == userID })
+	if isAdmin {
+		c.AdminIDs = append(c.AdminIDs, userID)
+	}
+}
+
+// AdminList returns a copy of the admin IDs
+func (c *Config) AdminList() []int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.AdminIDs)
+}
+
+// LegacyAdmins returns the admin usernames not yet resolved to user IDs
+func (c *Config) LegacyAdmins() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var usernames []string
+	for username, isAdmin := range c.Admins {
+		if isAdmin {
+			usernames = append(usernames, username)
+		}
+	}
+	slices.Sort(usernames)
+	return usernames
+}
+
+// ResolveLegacyAdmin replaces an admin username with the user ID it belongs to
+func (c *Config) ResolveLegacyAdmin(username string, userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.Admins, username)
+	if !slices.Contains(c.AdminIDs, userID) {
+		c.AdminIDs = append(c.AdminIDs, userID)
+	}
+}
+
+// jsonObject is a JSON object that keeps the order of its keys and their values as written
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// parseJSONObject reads the top level of a JSON object; empty data gives an empty object
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	obj := &jsonObject{values: make(map[string]json.RawMessage)}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return obj, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, errors.New("not a JSON object")
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj.set(key, value)
+	}
+	return obj, nil
+}
+
+// set replaces the value of a key, adding the key at the end if it is new
+func (o *jsonObject) set(key string, value json.RawMessage) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *jsonObject) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	o.keys = slices.DeleteFunc(o.keys, func(k string) bool { return k == key })
+}
+
+// marshal formats the object with two-space indentation
+func (o *jsonObject) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n  ")
+		buf.Write(name)
+		buf.WriteString(": ")
+
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, o.values[key]); err != nil {
+			return nil, err
+		}
+		if err := json.Indent(&buf, compact.Bytes(), "  ", "  "); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.keys) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
 }
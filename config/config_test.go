@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSaveConfigWritesOnlyAdmins(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{
+			name: "defaults stay out of the file",
+			file: `{"bot_token": "TOKEN", "admin_ids": [1], "sheets": {"spreadsheet_id": "S"}, "custom": {"keep": true}}`,
+			want: "{\n  \"bot_token\": \"TOKEN\",\n  \"admin_ids\": [\n    1,\n    2\n  ],\n  \"sheets\": {\n    \"spreadsheet_id\": \"S\"\n  },\n  \"custom\": {\n    \"keep\": true\n  }\n}\n",
+		},
+		{
+			name: "admin_ids is added when missing",
+			file: `{"bot_token": "TOKEN"}`,
+			want: "{\n  \"bot_token\": \"TOKEN\",\n  \"admin_ids\": [\n    2\n  ]\n}\n",
+		},
+		{
+			name: "resolved legacy admins are removed",
+			file: `{"admins": {"boss": true}, "bot_token": "TOKEN"}`,
+			want: "{\n  \"bot_token\": \"TOKEN\",\n  \"admin_ids\": [\n    2\n  ]\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			cfg.SetAdmin(2, true)
+			for _, username := range cfg.LegacyAdmins() {
+				cfg.ResolveLegacyAdmin(username, 2)
+			}
+
+			if err := SaveConfig(cfg, path); err != nil {
+				t.Fatalf("SaveConfig: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("saved config:\n%s\nwant:\n%s", data, tt.want)
+			}
+
+			// The file keeps its permissions and loads back with the same admins
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+				t.Errorf("file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+			}
+			reloaded, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig after save: %v", err)
+			}
+			if !slices.Equal(reloaded.AdminList(), cfg.AdminList()) {
+				t.Errorf("admins after reload = %v, want %v", reloaded.AdminList(), cfg.AdminList())
+			}
+		})
+	}
+}
+
+func TestLoadConfigIntervals(t *testing.T) {
+	tests := []struct {
+		name        string
+		sheets      string
+		wantErr     string
+		wantSummary int
+		wantReview  int
+	}{
+		{"defaults", `{}`, "", 60, 1},
+		{"zero takes defaults", `{"summary_interval_minutes": 0, "review_poll_interval_minutes": 0, "reconcile_interval_minutes": 0}`, "", 60, 1},
+		{"set values", `{"summary_interval_minutes": 15, "review_poll_interval_minutes": 5}`, "", 15, 5},
+		{"negative summary", `{"summary_interval_minutes": -1}`, "summary_interval_minutes", 0, 0},
+		{"negative review poll", `{"review_poll_interval_minutes": -5}`, "review_poll_interval_minutes", 0, 0},
+		{"negative reconcile", `{"reconcile_interval_minutes": -10}`, "reconcile_interval_minutes", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(`{"sheets": `+tt.sheets+`}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfig error = %v, want one about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.Sheets.SummaryIntervalMinutes != tt.wantSummary || cfg.Sheets.ReviewPollIntervalMinutes != tt.wantReview {
+				t.Errorf("intervals = %d, %d; want %d, %d", cfg.Sheets.SummaryIntervalMinutes,
+					cfg.Sheets.ReviewPollIntervalMinutes, tt.wantSummary, tt.wantReview)
+			}
+		})
+	}
+}
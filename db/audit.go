@@ -0,0 +1,25 @@
+package db
+
+import (
+	"telegram-bot/models"
+	"time"
+)
+
+// AddAuditEntry records an administrative action in the audit log
+func (db *DB) AddAuditEntry(entry *models.AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	query := `
+	INSERT INTO audit_log (time, actor_id, action, target_id, details)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := db.SQLite.Exec(query, entry.Time, entry.ActorID, entry.Action, entry.TargetID, entry.Details)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = result.LastInsertId()
+	return err
+}
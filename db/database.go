@@ -70,17 +70,184 @@ func (db *DB) InitDB() error {
 		phone TEXT,
 		is_admin BOOLEAN DEFAULT 0
 	);
+
+	CREATE TABLE IF NOT EXISTS groups (
+		chat_id INTEGER PRIMARY KEY,
+		title TEXT,
+		type TEXT,
+		registered_by INTEGER,
+		created_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sink TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		file_id INTEGER DEFAULT 0,
+		user_id INTEGER DEFAULT 0,
+		payload TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		next_attempt_at DATETIME,
+		last_error TEXT,
+		created_at DATETIME,
+		failed_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_outbox_user ON outbox (sink, user_id);
+	CREATE INDEX IF NOT EXISTS idx_outbox_file ON outbox (sink, file_id);
+
+	CREATE TABLE IF NOT EXISTS sheet_rows (
+		file_id INTEGER PRIMARY KEY,
+		user_id INTEGER,
+		sheet_name TEXT,
+		row_number INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sheet_rows_user ON sheet_rows (user_id);
+
+	CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		title TEXT,
+		permissions TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS departments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE COLLATE NOCASE
+	);
+
+	CREATE TABLE IF NOT EXISTS invites (
+		code TEXT PRIMARY KEY,
+		created_by INTEGER,
+		created_at DATETIME,
+		expires_at DATETIME,
+		used_by INTEGER DEFAULT 0,
+		used_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS phone_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		old_phone TEXT,
+		new_phone TEXT,
+		changed_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_phone_history_user ON phone_history (user_id);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time DATETIME,
+		actor_id INTEGER,
+		action TEXT NOT NULL,
+		target_id INTEGER,
+		details TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS erasure_requests (
+		user_id INTEGER PRIMARY KEY,
+		requested_at DATETIME
+	);
 	`
 
-	_, err := db.SQLite.Exec(query)
-	return err
+	if _, err := db.SQLite.Exec(query); err != nil {
+		return err
+	}
+
+	// Columns added after the first release
+	if err := db.addColumnIfMissing("users", "is_active", "BOOLEAN DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "role", "TEXT DEFAULT 'employee'"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "department_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "manager_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := db.SQLite.Exec(`CREATE INDEX IF NOT EXISTS idx_users_manager ON users (manager_id)`); err != nil {
+		return err
+	}
+	// Users registered before registration was restricted keep their access
+	if err := db.addColumnIfMissing("users", "approved", "BOOLEAN DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "employee_id", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "banned", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "offboarded", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "org_imported", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	// Profile filled in with /profile; timestamps stay empty for users registered before they were recorded
+	if err := db.addColumnIfMissing("users", "position", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "email", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "hire_date", "DATE"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "created_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "last_seen", "DATETIME"); err != nil {
+		return err
+	}
+
+	return db.seedRoles()
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.SQLite.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.SQLite.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
 }
 
-// SaveUser saves or updates a user in the database
+// SaveUser saves or updates a user in the database. The approval of an
+// existing user is not changed, use ApproveUser for that. The registration
+// time is set only when the user is created.
 func (db *DB) SaveUser(user *models.User) error {
 	query := `
-	INSERT INTO users (id, username, first_name, last_name, phone, is_admin)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT INTO users (id, username, first_name, last_name, phone, is_admin, approved, created_at, last_seen)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET
 		username = excluded.username,
 		first_name = excluded.first_name,
@@ -89,32 +256,151 @@ func (db *DB) SaveUser(user *models.User) error {
 		is_admin = excluded.is_admin
 	`
 
-	_, err := db.SQLite.Exec(query, user.ID, user.Username, user.FirstName, user.LastName, user.Phone, user.IsAdmin)
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	_, err := db.SQLite.Exec(query, user.ID, user.Username, user.FirstName, user.LastName, user.Phone, user.IsAdmin, user.Approved, user.CreatedAt, user.CreatedAt)
 	return err
 }
 
-// GetUser retrieves a user by ID
-func (db *DB) GetUser(id int64) (*models.User, error) {
-	query := `SELECT id, username, first_name, last_name, phone, is_admin FROM users WHERE id = ?`
+// ApproveUser lets a user finish registration, recording the employee ID they used if any
+func (db *DB) ApproveUser(id int64, employeeID string) error {
+	_, err := db.SQLite.Exec(`UPDATE users SET approved = 1, employee_id = ? WHERE id = ?`, employeeID, id)
+	return err
+}
+
+// GetUserByEmployeeID retrieves the user registered with an employee ID
+func (db *DB) GetUserByEmployeeID(employeeID string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE employee_id = ? COLLATE NOCASE`
 
+	user, err := scanUser(db.SQLite.QueryRow(query, employeeID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// GetAdminUsers retrieves all admins
+func (db *DB) GetAdminUsers() ([]*models.User, error) {
+	return db.queryUsers(`SELECT ` + userColumns + ` FROM users WHERE is_admin = 1 ORDER BY id`)
+}
+
+// userColumns are the columns read into models.User by scanUser. They are
+// selected from the users table, which the department subquery refers to.
+const userColumns = `id, username, first_name, last_name, phone, is_admin, is_active, role, department_id, manager_id, approved, employee_id, banned, offboarded,
+	org_imported, position, email, hire_date, created_at, last_seen,
+	(SELECT name FROM departments WHERE departments.id = users.department_id)`
+
+// scanUser reads a row selected with userColumns
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
 	var user models.User
-	err := db.SQLite.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Phone, &user.IsAdmin,
+	var department sql.NullString
+	var hireDate, createdAt, lastSeen sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Phone, &user.IsAdmin, &user.IsActive, &user.Role,
+		&user.DepartmentID, &user.ManagerID, &user.Approved, &user.EmployeeID, &user.Banned, &user.Offboarded,
+		&user.OrgImported, &user.Position, &user.Email, &hireDate, &createdAt, &lastSeen, &department,
 	)
+	if err != nil {
+		return nil, err
+	}
+	user.HireDate = hireDate.Time
+	user.CreatedAt = createdAt.Time
+	user.LastSeen = lastSeen.Time
+	user.Department = department.String
+	return &user, nil
+}
+
+// GetUser retrieves a user by ID
+func (db *DB) GetUser(id int64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
+	user, err := scanUser(db.SQLite.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	return user, err
+}
+
+// GetAllUsers retrieves all registered users
+func (db *DB) GetAllUsers() ([]*models.User, error) {
+	return db.queryUsers(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+}
+
+// queryUsers runs a query selecting userColumns
+func (db *DB) queryUsers(query string, args ...any) ([]*models.User, error) {
+	rows, err := db.SQLite.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &user, nil
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
 
-// UpdateUserPhone updates a user's phone number
+// UpdateUserPhone updates a user's phone number and records the change in the phone history
 func (db *DB) UpdateUserPhone(id int64, phone string) error {
-	query := `UPDATE users SET phone = ? WHERE id = ?`
-	_, err := db.SQLite.Exec(query, phone, id)
+	tx, err := db.SQLite.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldPhone sql.NullString
+	err = tx.QueryRow(`SELECT phone FROM users WHERE id = ?`, id).Scan(&oldPhone)
+	if err != nil {
+		return err
+	}
+	if oldPhone.String == phone {
+		return nil
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET phone = ? WHERE id = ?`, phone, id); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO phone_history (user_id, old_phone, new_phone, changed_at) VALUES (?, ?, ?, ?)`,
+		id, oldPhone.String, phone, time.Now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NormalizePhones rewrites stored phone numbers with the normalize function and
+// returns how many changed. Numbers it cannot normalize are left as they are.
+func (db *DB) NormalizePhones(normalize func(string) string) (int, error) {
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, user := range users {
+		phone := normalize(user.Phone)
+		if user.Phone == "" || phone == "" || phone == user.Phone {
+			continue
+		}
+		if _, err := db.SQLite.Exec(`UPDATE users SET phone = ? WHERE id = ?`, phone, user.ID); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// SetUserActive marks whether the bot can reach the user; blocking the bot makes a user inactive
+func (db *DB) SetUserActive(id int64, isActive bool) error {
+	query := `UPDATE users SET is_active = ? WHERE id = ?`
+	_, err := db.SQLite.Exec(query, isActive, id)
 	return err
 }
 
@@ -125,6 +411,12 @@ func (db *DB) SetUserAdmin(id int64, isAdmin bool) error {
 	return err
 }
 
+// FindUsersByUsername retrieves all users with the username, ignoring case.
+// Usernames can be given up and taken by someone else, so there may be several.
+func (db *DB) FindUsersByUsername(username string) ([]*models.User, error) {
+	return db.queryUsers(`SELECT `+userColumns+` FROM users WHERE username = ? COLLATE NOCASE ORDER BY id`, username)
+}
+
 // SaveFile saves a file to MongoDB
 func (db *DB) SaveFile(file *models.File) error {
 	// Check for duplicate file
@@ -167,6 +459,33 @@ func (db *DB) GetFile(id int64) (*models.File, error) {
 	return &file, nil
 }
 
+// GetFileInfo retrieves a file by ID without its contents
+func (db *DB) GetFileInfo(id int64) (*models.File, error) {
+	opts := options.FindOne().SetProjection(bson.M{"file_data": 0})
+
+	var file models.File
+	err := db.files.FindOne(context.Background(), bson.M{"_id": id}, opts).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UpdateFileReview stores a manager's review decision for a file
+func (db *DB) UpdateFileReview(id int64, review, comment string, reviewedAt time.Time) error {
+	_, err := db.files.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"review":         review,
+			"review_comment": comment,
+			"reviewed_at":    reviewedAt,
+		},
+	})
+	return err
+}
+
 // GetUserFiles retrieves all files for a user
 func (db *DB) GetUserFiles(userID int64) ([]*models.File, error) {
 	cursor, err := db.files.Find(context.Background(), bson.M{"user_id": userID})
@@ -182,6 +501,26 @@ func (db *DB) GetUserFiles(userID int64) ([]*models.File, error) {
 	return files, nil
 }
 
+// GetUsersFilesInfo retrieves the files of several users without their contents
+func (db *DB) GetUsersFilesInfo(userIDs []int64) ([]*models.File, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"file_data": 0})
+
+	cursor, err := db.files.Find(context.Background(), bson.M{"user_id": bson.M{"$in": userIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var files []*models.File
+	if err = cursor.All(context.Background(), &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // DeleteFile deletes a file by ID
 func (db *DB) DeleteFile(id int64) error {
 	_, err := db.files.DeleteOne(context.Background(), bson.M{"_id": id})
@@ -203,8 +542,39 @@ func (db *DB) GetAllFiles() ([]*models.File, error) {
 	return files, nil
 }
 
-// UpdateAdminStatuses updates admin status for all users based on the provided admin map
-func (db *DB) UpdateAdminStatuses(admins map[string]bool) error {
+// BackfillFileSizes records the size of files stored before it was saved with
+// the file, so that statistics and reports can be built without the contents.
+// It returns how many files were updated.
+func (db *DB) BackfillFileSizes() (int64, error) {
+	filter := bson.M{"size": bson.M{"$in": bson.A{nil, 0}}, "file_data": bson.M{"$exists": true}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"size": bson.M{"$binarySize": "$file_data"}}}}}
+
+	result, err := db.files.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// GetAllFilesInfo retrieves all files without their contents
+func (db *DB) GetAllFilesInfo() ([]*models.File, error) {
+	opts := options.Find().SetProjection(bson.M{"file_data": 0})
+
+	cursor, err := db.files.Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var files []*models.File
+	if err = cursor.All(context.Background(), &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// UpdateAdminStatuses makes admins exactly the users with the given IDs
+func (db *DB) UpdateAdminStatuses(adminIDs []int64) error {
 	// Start a transaction
 	tx, err := db.SQLite.Begin()
 	if err != nil {
@@ -219,12 +589,10 @@ func (db *DB) UpdateAdminStatuses(admins map[string]bool) error {
 	}
 
 	// Then update only those who are admins
-	for username, isAdmin := range admins {
-		if isAdmin {
-			_, err = tx.Exec("UPDATE users SET is_admin = 1 WHERE username = ?", username)
-			if err != nil {
-				return fmt.Errorf("failed to update admin status for %s: %w", username, err)
-			}
+	for _, id := range adminIDs {
+		_, err = tx.Exec("UPDATE users SET is_admin = 1 WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to update admin status for %d: %w", id, err)
 		}
 	}
 
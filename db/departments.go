@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"telegram-bot/models"
+)
+
+// GetOrCreateDepartment retrieves a department by name, creating it if needed
+func (db *DB) GetOrCreateDepartment(name string) (*models.Department, error) {
+	if _, err := db.SQLite.Exec(`INSERT OR IGNORE INTO departments (name) VALUES (?)`, name); err != nil {
+		return nil, err
+	}
+	return db.GetDepartmentByName(name)
+}
+
+// GetDepartmentByName retrieves a department by name, ignoring case
+func (db *DB) GetDepartmentByName(name string) (*models.Department, error) {
+	var department models.Department
+	err := db.SQLite.QueryRow(`SELECT id, name FROM departments WHERE name = ?`, name).
+		Scan(&department.ID, &department.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &department, nil
+}
+
+// GetDepartment retrieves a department by ID
+func (db *DB) GetDepartment(id int64) (*models.Department, error) {
+	var department models.Department
+	err := db.SQLite.QueryRow(`SELECT id, name FROM departments WHERE id = ?`, id).
+		Scan(&department.ID, &department.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &department, nil
+}
+
+// SetUserOrg sets a user's department and direct manager; zero clears them.
+// From then on the department is no longer edited in the user's profile.
+func (db *DB) SetUserOrg(userID, departmentID, managerID int64) error {
+	_, err := db.SQLite.Exec(`UPDATE users SET department_id = ?, manager_id = ?, org_imported = 1 WHERE id = ?`,
+		departmentID, managerID, userID)
+	return err
+}
+
+// GetDepartmentUsers retrieves the users of a department
+func (db *DB) GetDepartmentUsers(departmentID int64) ([]*models.User, error) {
+	return db.queryUsers(`SELECT `+userColumns+` FROM users WHERE department_id = ? ORDER BY id`, departmentID)
+}
+
+// GetReportIDs returns the IDs of the direct and indirect reports of a manager
+func (db *DB) GetReportIDs(managerID int64) ([]int64, error) {
+	// UNION drops rows already seen, so a cycle in the hierarchy ends the recursion
+	query := `
+	WITH RECURSIVE reports(id) AS (
+		SELECT id FROM users WHERE manager_id = ? AND id != ?
+		UNION
+		SELECT users.id FROM users JOIN reports ON users.manager_id = reports.id
+	)
+	SELECT id FROM reports WHERE id != ?
+	`
+
+	rows, err := db.SQLite.Query(query, managerID, managerID, managerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
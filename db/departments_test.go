@@ -0,0 +1,82 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"telegram-bot/models"
+	"testing"
+	"time"
+)
+
+// newTestDB creates a database in a temporary directory. MongoDB is not needed:
+// the connection is made only on the first query to the files.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	database, err := NewDB(filepath.Join(t.TempDir(), "bot.db"), "mongodb://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	return database
+}
+
+// saveTestUsers stores users with the given managers: user ID -> manager ID
+func saveTestUsers(t *testing.T, database *DB, managers map[int64]int64) {
+	t.Helper()
+
+	for id, managerID := range managers {
+		now := time.Now()
+		if err := database.SaveUser(&models.User{ID: id, CreatedAt: now, LastSeen: now}); err != nil {
+			t.Fatalf("SaveUser(%d): %v", id, err)
+		}
+		if err := database.SetUserOrg(id, 0, managerID); err != nil {
+			t.Fatalf("SetUserOrg(%d): %v", id, err)
+		}
+	}
+}
+
+func TestGetReportIDs(t *testing.T) {
+	database := newTestDB(t)
+	saveTestUsers(t, database, map[int64]int64{
+		// 1 <- 2 <- 3, and 10 without a manager
+		1: 0, 2: 1, 3: 2, 10: 0,
+		// 4 <-> 5
+		4: 5, 5: 4,
+		// 6 manages itself
+		6: 6,
+		// 7 <- 8 <- 9 <- 7
+		7: 9, 8: 7, 9: 8,
+	})
+
+	tests := []struct {
+		name      string
+		managerID int64
+		want      []int64
+	}{
+		{"direct and indirect reports", 1, []int64{2, 3}},
+		{"middle of the chain", 2, []int64{3}},
+		{"no reports", 3, nil},
+		{"unknown manager", 100, nil},
+		{"two-user cycle", 4, []int64{5}},
+		{"own manager", 6, nil},
+		{"longer cycle", 7, []int64{8, 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.GetReportIDs(tt.managerID)
+			if err != nil {
+				t.Fatalf("GetReportIDs: %v", err)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetReportIDs(%d) = %v, want %v", tt.managerID, got, tt.want)
+			}
+		})
+	}
+}
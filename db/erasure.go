@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"telegram-bot/models"
+	"time"
+)
+
+// GetPhoneHistory retrieves the phone number changes of a user, oldest first
+func (db *DB) GetPhoneHistory(userID int64) ([]*models.PhoneChange, error) {
+	rows, err := db.SQLite.Query(`
+	SELECT old_phone, new_phone, changed_at FROM phone_history
+	WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*models.PhoneChange
+	for rows.Next() {
+		var change models.PhoneChange
+		var oldPhone, newPhone sql.NullString
+		if err := rows.Scan(&oldPhone, &newPhone, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		change.OldPhone = oldPhone.String
+		change.NewPhone = newPhone.String
+		changes = append(changes, &change)
+	}
+	return changes, rows.Err()
+}
+
+// RequestErasure records a user's request to erase their data.
+// It reports false if the user already has a pending request.
+func (db *DB) RequestErasure(userID int64) (bool, error) {
+	result, err := db.SQLite.Exec(`INSERT OR IGNORE INTO erasure_requests (user_id, requested_at) VALUES (?, ?)`,
+		userID, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// TakeErasureRequest removes a pending erasure request once it is approved or rejected.
+// It reports false if there was no such request, so a decision is applied only once.
+func (db *DB) TakeErasureRequest(userID int64) (bool, error) {
+	result, err := db.SQLite.Exec(`DELETE FROM erasure_requests WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// EraseUser deletes a user and their phone history from SQLite and unlinks them
+// from their reports and invites. Files in MongoDB are deleted with DeleteUserFiles;
+// the sheet row index is kept so the spreadsheet rows can still be anonymized.
+func (db *DB) EraseUser(userID int64) error {
+	tx, err := db.SQLite.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM users WHERE id = ?`,
+		`DELETE FROM phone_history WHERE user_id = ?`,
+		`DELETE FROM erasure_requests WHERE user_id = ?`,
+		`UPDATE users SET manager_id = 0 WHERE manager_id = ?`,
+		`UPDATE invites SET created_by = 0 WHERE created_by = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
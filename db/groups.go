@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"telegram-bot/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaveGroup registers a group chat or updates its details
+func (db *DB) SaveGroup(group *models.Group) error {
+	query := `
+	INSERT INTO groups (chat_id, title, type, registered_by, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET
+		title = excluded.title,
+		type = excluded.type
+	`
+
+	_, err := db.SQLite.Exec(query, group.ChatID, group.Title, group.Type, group.RegisteredBy, group.CreatedAt)
+	return err
+}
+
+// GetGroup retrieves a registered group by chat ID
+func (db *DB) GetGroup(chatID int64) (*models.Group, error) {
+	query := `SELECT chat_id, title, type, registered_by, created_at FROM groups WHERE chat_id = ?`
+
+	var group models.Group
+	err := db.SQLite.QueryRow(query, chatID).Scan(
+		&group.ChatID, &group.Title, &group.Type, &group.RegisteredBy, &group.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// GetGroups retrieves all registered groups
+func (db *DB) GetGroups() ([]*models.Group, error) {
+	query := `SELECT chat_id, title, type, registered_by, created_at FROM groups ORDER BY title`
+
+	rows, err := db.SQLite.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		var group models.Group
+		if err := rows.Scan(&group.ChatID, &group.Title, &group.Type, &group.RegisteredBy, &group.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, &group)
+	}
+	return groups, rows.Err()
+}
+
+// DeleteGroup removes a group from the registered team channels
+func (db *DB) DeleteGroup(chatID int64) error {
+	_, err := db.SQLite.Exec(`DELETE FROM groups WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// GetGroupFilesInfo retrieves the files uploaded in a group chat without their contents
+func (db *DB) GetGroupFilesInfo(chatID int64) ([]*models.File, error) {
+	opts := options.Find().SetProjection(bson.M{"file_data": 0})
+
+	cursor, err := db.files.Find(context.Background(), bson.M{"chat_id": chatID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var files []*models.File
+	if err = cursor.All(context.Background(), &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CountGroupFiles returns the number of files uploaded in a group chat
+func (db *DB) CountGroupFiles(chatID int64) (int64, error) {
+	return db.files.CountDocuments(context.Background(), bson.M{"chat_id": chatID})
+}
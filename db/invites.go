@@ -0,0 +1,33 @@
+package db
+
+import (
+	"telegram-bot/models"
+	"time"
+)
+
+// SaveInvite stores a new invite code
+func (db *DB) SaveInvite(invite *models.Invite) error {
+	query := `
+	INSERT INTO invites (code, created_by, created_at, expires_at)
+	VALUES (?, ?, ?, ?)
+	`
+
+	_, err := db.SQLite.Exec(query, invite.Code, invite.CreatedBy, invite.CreatedAt, invite.ExpiresAt)
+	return err
+}
+
+// RedeemInvite marks an unused, unexpired invite code as used by the user.
+// It reports false if there is no such code.
+func (db *DB) RedeemInvite(code string, userID int64) (bool, error) {
+	now := time.Now()
+	result, err := db.SQLite.Exec(`
+	UPDATE invites SET used_by = ?, used_at = ?
+	WHERE code = ? AND used_by = 0 AND expires_at > ?
+	`, userID, now, code, now)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
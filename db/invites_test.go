@@ -0,0 +1,48 @@
+package db
+
+import (
+	"telegram-bot/models"
+	"testing"
+	"time"
+)
+
+func TestRedeemInvite(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expires time.Time
+		redeems []int64 // users redeeming the code in turn
+		want    []bool
+	}{
+		{"valid code is used once", now.Add(time.Hour), []int64{10, 10}, []bool{true, false}},
+		{"used code does not pass to another user", now.Add(time.Hour), []int64{10, 20}, []bool{true, false}},
+		{"expired code", now.Add(-time.Second), []int64{10}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDB(t)
+			invite := &models.Invite{Code: "ABCD2345", CreatedBy: 1, CreatedAt: now, ExpiresAt: tt.expires}
+			if err := database.SaveInvite(invite); err != nil {
+				t.Fatalf("SaveInvite: %v", err)
+			}
+
+			for i, userID := range tt.redeems {
+				got, err := database.RedeemInvite(invite.Code, userID)
+				if err != nil {
+					t.Fatalf("RedeemInvite: %v", err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("redeem %d by user %d = %v, want %v", i, userID, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("unknown code", func(t *testing.T) {
+		database := newTestDB(t)
+		if got, err := database.RedeemInvite("NOSUCH", 10); err != nil || got {
+			t.Errorf("RedeemInvite = %v, %v; want false", got, err)
+		}
+	})
+}
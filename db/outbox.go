@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"telegram-bot/models"
+	"time"
+)
+
+// EnqueueOutbox adds a pending write for the given sink to the outbox.
+// fileID is zero for events about all files of a user.
+func (db *DB) EnqueueOutbox(sink, kind string, fileID, userID int64, payload string) error {
+	query := `
+	INSERT INTO outbox (sink, kind, file_id, user_id, payload, attempts, next_attempt_at, last_error, created_at)
+	VALUES (?, ?, ?, ?, ?, 0, ?, '', ?)
+	`
+
+	now := time.Now()
+	_, err := db.SQLite.Exec(query, sink, kind, fileID, userID, payload, now, now)
+	return err
+}
+
+// Columns read into models.OutboxEntry by scanOutbox
+const outboxColumns = `id, sink, kind, file_id, user_id, payload, attempts, next_attempt_at, last_error, created_at, failed_at`
+
+// GetDueOutbox retrieves up to limit outbox entries that are due for an attempt, oldest first.
+// An entry waits while an older entry of the same sink about the same user or file is
+// waiting for a retry, so that, for example, a delete never overtakes its upload.
+// Entries that ran out of attempts are not retried.
+func (db *DB) GetDueOutbox(limit int) ([]*models.OutboxEntry, error) {
+	query := `
+	SELECT ` + outboxColumns + `
+	FROM outbox
+	WHERE failed_at IS NULL AND next_attempt_at <= ?
+	AND NOT EXISTS (
+		SELECT 1 FROM outbox AS older
+		WHERE older.sink = outbox.sink AND older.id < outbox.id
+		AND older.failed_at IS NULL AND older.next_attempt_at > ?
+		AND (older.user_id = outbox.user_id OR (outbox.file_id != 0 AND older.file_id = outbox.file_id))
+	)
+	ORDER BY id
+	LIMIT ?
+	`
+
+	now := time.Now()
+	return db.queryOutbox(query, now, now, limit)
+}
+
+// GetFailedOutbox retrieves up to limit entries that ran out of attempts, oldest first
+func (db *DB) GetFailedOutbox(limit int) ([]*models.OutboxEntry, error) {
+	return db.queryOutbox(`SELECT `+outboxColumns+` FROM outbox WHERE failed_at IS NOT NULL ORDER BY id LIMIT ?`, limit)
+}
+
+// queryOutbox runs a query selecting outboxColumns
+func (db *DB) queryOutbox(query string, args ...any) ([]*models.OutboxEntry, error) {
+	rows, err := db.SQLite.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.OutboxEntry
+	for rows.Next() {
+		var entry models.OutboxEntry
+		var failedAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.Sink, &entry.Kind, &entry.FileID, &entry.UserID, &entry.Payload, &entry.Attempts,
+			&entry.NextAttemptAt, &entry.LastError, &entry.CreatedAt, &failedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.FailedAt = failedAt.Time
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// RescheduleOutbox records a failed attempt and sets the time of the next one
+func (db *DB) RescheduleOutbox(id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	query := `UPDATE outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`
+	_, err := db.SQLite.Exec(query, attempts, nextAttemptAt, lastError, id)
+	return err
+}
+
+// PendingOutboxKeys returns the files and users with entries of the sink still waiting
+// for delivery. users holds only users with events about all their files.
+func (db *DB) PendingOutboxKeys(sink string) (files, users map[int64]bool, err error) {
+	rows, err := db.SQLite.Query(`SELECT DISTINCT file_id, user_id FROM outbox WHERE sink = ? AND failed_at IS NULL`, sink)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	files = make(map[int64]bool)
+	users = make(map[int64]bool)
+	for rows.Next() {
+		var fileID, userID int64
+		if err := rows.Scan(&fileID, &userID); err != nil {
+			return nil, nil, err
+		}
+		if fileID != 0 {
+			files[fileID] = true
+		} else {
+			users[userID] = true
+		}
+	}
+	return files, users, rows.Err()
+}
+
+// FailOutbox records the last failed attempt of an entry and stops retrying it
+func (db *DB) FailOutbox(id int64, attempts int, lastError string) error {
+	query := `UPDATE outbox SET attempts = ?, last_error = ?, failed_at = ? WHERE id = ?`
+	_, err := db.SQLite.Exec(query, attempts, lastError, time.Now(), id)
+	return err
+}
+
+// RetryFailedOutbox queues all failed entries for delivery again and returns how many there were
+func (db *DB) RetryFailedOutbox() (int64, error) {
+	query := `UPDATE outbox SET attempts = 0, next_attempt_at = ?, failed_at = NULL WHERE failed_at IS NOT NULL`
+	result, err := db.SQLite.Exec(query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteFailedOutbox removes all failed entries and returns how many there were
+func (db *DB) DeleteFailedOutbox() (int64, error) {
+	result, err := db.SQLite.Exec(`DELETE FROM outbox WHERE failed_at IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteOutbox removes an entry once it has been delivered
+func (db *DB) DeleteOutbox(id int64) error {
+	_, err := db.SQLite.Exec(`DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+// DeleteUserOutbox removes all entries about a user, including failed ones, and returns how many there were
+func (db *DB) DeleteUserOutbox(userID int64) (int64, error) {
+	result, err := db.SQLite.Exec(`DELETE FROM outbox WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountOutbox returns the number of entries waiting for delivery and of entries that ran out of attempts
+func (db *DB) CountOutbox() (pending, failed int64, err error) {
+	query := `SELECT COUNT(*) - COUNT(failed_at), COUNT(failed_at) FROM outbox`
+	err = db.SQLite.QueryRow(query).Scan(&pending, &failed)
+	return pending, failed, err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"telegram-bot/models"
+)
+
+// seedRoles creates the built-in roles that are missing from the roles table
+func (db *DB) seedRoles() error {
+	for _, role := range models.DefaultRoles {
+		_, err := db.SQLite.Exec(`INSERT OR IGNORE INTO roles (name, title, permissions) VALUES (?, ?, ?)`,
+			role.Name, role.Title, strings.Join(role.Permissions, " "))
+		if err != nil {
+			return fmt.Errorf("failed to create role %s: %w", role.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetRole retrieves a role by name
+func (db *DB) GetRole(name string) (*models.Role, error) {
+	query := `SELECT name, title, permissions FROM roles WHERE name = ?`
+
+	var role models.Role
+	var permissions string
+	err := db.SQLite.QueryRow(query, name).Scan(&role.Name, &role.Title, &permissions)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role.Permissions = strings.Fields(permissions)
+	return &role, nil
+}
+
+// GetRoles retrieves all roles
+func (db *DB) GetRoles() ([]*models.Role, error) {
+	rows, err := db.SQLite.Query(`SELECT name, title, permissions FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		var role models.Role
+		var permissions string
+		if err := rows.Scan(&role.Name, &role.Title, &permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = strings.Fields(permissions)
+		roles = append(roles, &role)
+	}
+	return roles, rows.Err()
+}
+
+// SetUserRole assigns a role to a user
+func (db *DB) SetUserRole(id int64, role string) error {
+	_, err := db.SQLite.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	return err
+}
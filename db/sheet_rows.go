@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"telegram-bot/models"
+)
+
+// SaveSheetRow stores or updates the spreadsheet row of a file
+func (db *DB) SaveSheetRow(row *models.SheetRow) error {
+	query := `
+	INSERT INTO sheet_rows (file_id, user_id, sheet_name, row_number)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(file_id) DO UPDATE SET
+		user_id = excluded.user_id,
+		sheet_name = excluded.sheet_name,
+		row_number = excluded.row_number
+	`
+
+	_, err := db.SQLite.Exec(query, row.FileID, row.UserID, row.SheetName, row.Row)
+	return err
+}
+
+// GetSheetRow retrieves the spreadsheet row of a file
+func (db *DB) GetSheetRow(fileID int64) (*models.SheetRow, error) {
+	query := `SELECT file_id, user_id, sheet_name, row_number FROM sheet_rows WHERE file_id = ?`
+
+	var row models.SheetRow
+	err := db.SQLite.QueryRow(query, fileID).Scan(&row.FileID, &row.UserID, &row.SheetName, &row.Row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// GetUserSheetRows retrieves the spreadsheet rows of all files of a user
+func (db *DB) GetUserSheetRows(userID int64) ([]*models.SheetRow, error) {
+	query := `SELECT file_id, user_id, sheet_name, row_number FROM sheet_rows WHERE user_id = ? ORDER BY row_number`
+
+	rows, err := db.SQLite.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.SheetRow
+	for rows.Next() {
+		var row models.SheetRow
+		if err := rows.Scan(&row.FileID, &row.UserID, &row.SheetName, &row.Row); err != nil {
+			return nil, err
+		}
+		result = append(result, &row)
+	}
+	return result, rows.Err()
+}
+
+// ReplaceSheetRows replaces the whole index of a sheet with the given rows
+func (db *DB) ReplaceSheetRows(sheetName string, rows []*models.SheetRow) error {
+	tx, err := db.SQLite.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM sheet_rows WHERE sheet_name = ?`, sheetName); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO sheet_rows (file_id, user_id, sheet_name, row_number)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(file_id) DO UPDATE SET
+		user_id = excluded.user_id,
+		sheet_name = excluded.sheet_name,
+		row_number = excluded.row_number
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row.FileID, row.UserID, sheetName, row.Row); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PruneSheetRows removes index rows of sheets other than the given ones
+func (db *DB) PruneSheetRows(sheetNames []string) error {
+	if len(sheetNames) == 0 {
+		_, err := db.SQLite.Exec(`DELETE FROM sheet_rows`)
+		return err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(sheetNames)), ",")
+	args := make([]interface{}, len(sheetNames))
+	for i, name := range sheetNames {
+		args[i] = name
+	}
+
+	_, err := db.SQLite.Exec(`DELETE FROM sheet_rows WHERE sheet_name NOT IN (`+placeholders+`)`, args...)
+	return err
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserFilter narrows a list of users; zero fields match everyone
+type UserFilter struct {
+	// Part of the username, first or last name
+	Search         string
+	Role           string
+	DepartmentID   int64
+	AdminsOnly     bool
+	BannedOnly     bool
+	InactiveOnly   bool
+	OffboardedOnly bool
+}
+
+// ListUsers retrieves a page of users matching the filter and the total number of matches
+func (db *DB) ListUsers(filter UserFilter, offset, limit int) ([]*models.User, int, error) {
+	var where []string
+	var args []any
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		where = append(where, `(username LIKE ? OR first_name LIKE ? OR last_name LIKE ?)`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		where = append(where, `role = ?`)
+		args = append(args, filter.Role)
+	}
+	if filter.DepartmentID != 0 {
+		where = append(where, `department_id = ?`)
+		args = append(args, filter.DepartmentID)
+	}
+	if filter.AdminsOnly {
+		where = append(where, `is_admin = 1`)
+	}
+	if filter.BannedOnly {
+		where = append(where, `banned = 1`)
+	}
+	if filter.InactiveOnly {
+		where = append(where, `is_active = 0`)
+	}
+	if filter.OffboardedOnly {
+		where = append(where, `offboarded = 1`)
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := db.SQLite.QueryRow(`SELECT COUNT(*) FROM users`+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	users, err := db.queryUsers(`SELECT `+userColumns+` FROM users`+clause+` ORDER BY id LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	return users, total, err
+}
+
+// SetUserBanned blocks or unblocks a user
+func (db *DB) SetUserBanned(id int64, banned bool) error {
+	_, err := db.SQLite.Exec(`UPDATE users SET banned = ? WHERE id = ?`, banned, id)
+	return err
+}
+
+// OffboardUser deactivates the account of a user who left and drops their admin flag.
+// It reports false if the user was already offboarded, so the flow runs only once.
+func (db *DB) OffboardUser(id int64) (bool, error) {
+	result, err := db.SQLite.Exec(`UPDATE users SET offboarded = 1, is_admin = 0 WHERE id = ? AND offboarded = 0`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// FileStats summarizes the files of a user
+type FileStats struct {
+	Count      int64
+	Size       int64
+	LastUpload time.Time
+}
+
+// GetUserFileStats counts the files of a user and their total size
+func (db *DB) GetUserFileStats(userID int64) (*FileStats, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         nil,
+			"count":       bson.M{"$sum": 1},
+			"size":        bson.M{"$sum": "$size"},
+			"last_upload": bson.M{"$max": "$created_at"},
+		}}},
+	}
+
+	cursor, err := db.files.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []struct {
+		Count      int64     `bson:"count"`
+		Size       int64     `bson:"size"`
+		LastUpload time.Time `bson:"last_upload"`
+	}
+	if err := cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+
+	stats := &FileStats{}
+	if len(results) > 0 {
+		stats.Count = results[0].Count
+		stats.Size = results[0].Size
+		stats.LastUpload = results[0].LastUpload
+	}
+	return stats, nil
+}
+
+// ReassignUserFiles hands all files of one user over to another and returns the moved files without their contents
+func (db *DB) ReassignUserFiles(fromUserID, toUserID int64) ([]*models.File, error) {
+	files, err := db.GetUsersFilesInfo([]int64{fromUserID})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+		file.UserID = toUserID
+	}
+
+	// Only the listed files move, so a file uploaded meanwhile stays with its owner
+	_, err = db.files.UpdateMany(context.Background(),
+		bson.M{"_id": bson.M{"$in": ids}, "user_id": fromUserID},
+		bson.M{"$set": bson.M{"user_id": toUserID}})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// TouchUser records that the user has just written to the bot
+func (db *DB) TouchUser(id int64) error {
+	_, err := db.SQLite.Exec(`UPDATE users SET last_seen = ? WHERE id = ?`, time.Now(), id)
+	return err
+}
+
+// UpdateUserProfile saves the profile fields a user edits with /profile.
+// A department set by an org import is kept.
+func (db *DB) UpdateUserProfile(user *models.User) error {
+	var hireDate any
+	if !user.HireDate.IsZero() {
+		hireDate = user.HireDate
+	}
+	_, err := db.SQLite.Exec(`
+	UPDATE users SET position = ?, email = ?, employee_id = ?,
+		department_id = CASE WHEN org_imported THEN department_id ELSE ? END, hire_date = ?
+	WHERE id = ?
+	`, user.Position, user.Email, user.EmployeeID, user.DepartmentID, hireDate, user.ID)
+	return err
+}
@@ -0,0 +1,340 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telegram-bot/db"
+	"telegram-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// access holds the permissions of one user for the duration of a command.
+// All file access checks go through it.
+type access struct {
+	bot  *Bot
+	user *models.User
+	role *models.Role
+
+	// Team channels the user belongs to, looked up once per command
+	chats map[int64]bool
+
+	// Direct and indirect reports of the user, loaded on first use
+	reports map[int64]bool
+}
+
+// accessFor loads the role of a user. Unregistered, banned and offboarded users get no permissions.
+// Admins from the config keep every permission whatever their role.
+func (b *Bot) accessFor(userID int64) (*access, error) {
+	user, err := b.DB.GetUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user != nil && user.Blocked() {
+		user = nil
+	}
+
+	a := &access{bot: b, user: user, role: &models.Role{}, chats: make(map[int64]bool)}
+	if user == nil {
+		return a, nil
+	}
+
+	a.role, err = b.roleOf(user)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// roleOf returns the role that grants the user's permissions, whether or not the user is blocked.
+// Admins from the config get every permission; an unknown role grants none.
+func (b *Bot) roleOf(user *models.User) (*models.Role, error) {
+	if user.IsAdmin {
+		return &models.Role{Name: models.RoleSuperadmin, Permissions: models.AllPermissions}, nil
+	}
+
+	role, err := b.DB.GetRole(user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role %s: %w", user.Role, err)
+	}
+	if role == nil {
+		log.Printf("Warning: user %d has unknown role %q", user.ID, user.Role)
+		return &models.Role{}, nil
+	}
+	return role, nil
+}
+
+// can reports whether the user has the permission
+func (a *access) can(permission string) bool {
+	return a.role.Has(permission)
+}
+
+// outranks reports whether the user has every permission of the target's role.
+// Commands that change another user are refused otherwise, so nobody can act on
+// a user with rights they do not have themselves.
+func (a *access) outranks(target *models.User) (bool, error) {
+	if a.user == nil {
+		return false, nil
+	}
+	role, err := a.bot.roleOf(target)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range role.Permissions {
+		if !a.can(permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// canView reports whether the user may see the file
+func (a *access) canView(file *models.File) bool {
+	if a.user == nil {
+		return false
+	}
+	if a.can(models.PermissionViewAll) {
+		return true
+	}
+	if file.UserID == a.user.ID && a.can(models.PermissionViewOwn) {
+		return true
+	}
+	if a.can(models.PermissionViewTeam) && file.ChatID != 0 && a.inChat(file.ChatID) {
+		return true
+	}
+	// Managers see the files of everyone below them in the hierarchy
+	return a.isReport(file.UserID)
+}
+
+// canDelete reports whether the user may delete the file
+func (a *access) canDelete(file *models.File) bool {
+	if a.user == nil {
+		return false
+	}
+	return file.UserID == a.user.ID || a.can(models.PermissionDeleteAny)
+}
+
+// inChat reports whether the user is a member of the team channel
+func (a *access) inChat(chatID int64) bool {
+	if member, ok := a.chats[chatID]; ok {
+		return member
+	}
+
+	member := a.bot.isChatMember(chatID, a.user.ID)
+	a.chats[chatID] = member
+	return member
+}
+
+// reportIDs returns the direct and indirect reports of the user
+func (a *access) reportIDs() []int64 {
+	if a.reports == nil {
+		a.reports = make(map[int64]bool)
+		ids, err := a.bot.DB.GetReportIDs(a.user.ID)
+		if err != nil {
+			log.Printf("Error getting reports of user %d: %v", a.user.ID, err)
+		}
+		for _, id := range ids {
+			a.reports[id] = true
+		}
+	}
+
+	ids := make([]int64, 0, len(a.reports))
+	for id := range a.reports {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// isReport reports whether the user is above the given user in the hierarchy
+func (a *access) isReport(userID int64) bool {
+	a.reportIDs()
+	return a.reports[userID]
+}
+
+// filterVisible keeps only the files the user may see
+func (a *access) filterVisible(files []*models.File) []*models.File {
+	var visible []*models.File
+	for _, file := range files {
+		if a.canView(file) {
+			visible = append(visible, file)
+		}
+	}
+	return visible
+}
+
+// isChatMember asks Telegram whether the user is a member of the chat
+func (b *Bot) isChatMember(chatID, userID int64) bool {
+	member, err := b.API.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		log.Printf("Error checking membership of user %d in chat %d: %v", userID, chatID, err)
+		return false
+	}
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return member.IsMember
+	}
+	return false
+}
+
+// isAdminUser reports whether the registered user with the given ID is an admin
+func (b *Bot) isAdminUser(userID int64) bool {
+	a, err := b.accessFor(userID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		return false
+	}
+	return a.user != nil && (a.user.IsAdmin || a.user.Role == models.RoleSuperadmin)
+}
+
+// findUser resolves a user given as @username or numeric ID
+func (b *Bot) findUser(arg string) (*models.User, error) {
+	return lookupUser(b.DB, arg)
+}
+
+// ambiguousUserError is returned by lookupUser when a username belongs to several
+// users. Usernames can change hands, so only a numeric ID names a user reliably.
+type ambiguousUserError struct {
+	username string
+	ids      []int64
+}
+
+func (e *ambiguousUserError) Error() string {
+	return fmt.Sprintf("username @%s matches %d users", e.username, len(e.ids))
+}
+
+// text tells the sender which IDs to choose from
+func (e *ambiguousUserError) text() string {
+	ids := make([]string, len(e.ids))
+	for i, id := range e.ids {
+		ids[i] = fmt.Sprint(id)
+	}
+	return fmt.Sprintf("Username @%s есть у нескольких пользователей (ID: %s). Укажите числовой ID.", e.username, strings.Join(ids, ", "))
+}
+
+// lookupUser resolves a user given as @username or numeric ID
+func lookupUser(database *db.DB, arg string) (*models.User, error) {
+	arg = strings.TrimSpace(arg)
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return database.GetUser(id)
+	}
+
+	username := strings.TrimPrefix(arg, "@")
+	users, err := database.FindUsersByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	switch len(users) {
+	case 0:
+		return nil, nil
+	case 1:
+		return users[0], nil
+	}
+	ambiguous := &ambiguousUserError{username: username}
+	for _, user := range users {
+		ambiguous.ids = append(ambiguous.ids, user.ID)
+	}
+	return nil, ambiguous
+}
+
+// sendLookupError tells the sender why findUser failed
+func (b *Bot) sendLookupError(chatID int64, err error) {
+	var ambiguous *ambiguousUserError
+	if errors.As(err, &ambiguous) {
+		b.send(tgbotapi.NewMessage(chatID, ambiguous.text()))
+		return
+	}
+	log.Printf("Error getting user: %v", err)
+	b.send(tgbotapi.NewMessage(chatID, "Ошибка при поиске пользователя."))
+}
+
+// handleSetRoleCommand assigns a role to a user: /setrole @username role.
+// A user can only hand out roles whose permissions they have themselves,
+// and only to users who have no more rights than they do.
+func (b *Bot) handleSetRoleCommand(message *tgbotapi.Message) {
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа."))
+		return
+	}
+	if !a.can(models.PermissionManageUsers) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только пользователям с правом управления пользователями."))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		b.sendRoles(message.Chat.ID, "Укажите пользователя и роль. Например: /setrole @username team_lead")
+		return
+	}
+
+	target, err := b.findUser(args[0])
+	if err != nil {
+		b.sendLookupError(message.Chat.ID, err)
+		return
+	}
+	if target == nil {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Пользователь не найден. Он должен хотя бы раз написать боту."))
+		return
+	}
+	if ok, err := a.outranks(target); err != nil {
+		log.Printf("Error checking access: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа."))
+		return
+	} else if !ok {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Нельзя менять роль пользователя, у которого есть права, которых нет у вас."))
+		return
+	}
+
+	role, err := b.DB.GetRole(args[1])
+	if err != nil {
+		log.Printf("Error getting role: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении роли."))
+		return
+	}
+	if role == nil {
+		b.sendRoles(message.Chat.ID, fmt.Sprintf("Роль %q не найдена.", args[1]))
+		return
+	}
+
+	for _, permission := range role.Permissions {
+		if !a.can(permission) {
+			b.send(tgbotapi.NewMessage(message.Chat.ID, "Нельзя назначить роль с правами, которых нет у вас."))
+			return
+		}
+	}
+
+	if err := b.DB.SetUserRole(target.ID, role.Name); err != nil {
+		log.Printf("Error setting user role: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при назначении роли."))
+		return
+	}
+
+	log.Printf("User %d set role of user %d to %s", message.From.ID, target.ID, role.Name)
+	b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ Пользователю %s назначена роль «%s».", displayName(target), role.Title)))
+}
+
+// sendRoles sends a message followed by the list of roles and their permissions
+func (b *Bot) sendRoles(chatID int64, text string) {
+	roles, err := b.DB.GetRoles()
+	if err != nil {
+		log.Printf("Error getting roles: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(text)
+	response.WriteString("\n\nРоли:\n")
+	for _, role := range roles {
+		response.WriteString(fmt.Sprintf("%s — %s: %s\n", role.Name, role.Title, strings.Join(role.Permissions, ", ")))
+	}
+	b.sendText(chatID, response.String())
+}
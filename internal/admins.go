@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telegram-bot/config"
+	"telegram-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleAdminChange grants or revokes admin rights: /promote @username, /demote @username.
+// A numeric user ID can be given instead, also for users who have not written to the bot yet.
+// The change is saved to the config file and recorded in the audit log.
+func (b *Bot) handleAdminChange(message *tgbotapi.Message, promote bool) {
+	if !b.isAdminUser(message.From.ID) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только администраторам."))
+		return
+	}
+	if b.Config.Path == "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Изменение администраторов недоступно: бот запущен без файла конфигурации."))
+		return
+	}
+
+	command := "/demote"
+	if promote {
+		command = "/promote"
+	}
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" || strings.ContainsAny(arg, " \t") {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Укажите пользователя. Например: %s @username или %s 123456789", command, command)))
+		return
+	}
+
+	var userID int64
+	name := arg
+	target, err := b.findUser(arg)
+	if err != nil {
+		b.sendLookupError(message.Chat.ID, err)
+		return
+	}
+	if target != nil {
+		userID = target.ID
+		name = displayName(target)
+	} else if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		userID = id
+	} else {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Пользователь не найден. Он должен хотя бы раз написать боту, или укажите его числовой ID."))
+		return
+	}
+
+	if !promote && userID == message.From.ID {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Нельзя снять права администратора с самого себя."))
+		return
+	}
+	if b.Config.IsAdmin(userID) == promote {
+		status := "не является администратором"
+		if promote {
+			status = "уже администратор"
+		}
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("%s %s.", name, status)))
+		return
+	}
+
+	b.Config.SetAdmin(userID, promote)
+	if err := config.SaveConfig(b.Config, b.Config.Path); err != nil {
+		b.Config.SetAdmin(userID, !promote)
+		log.Printf("Error saving config: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при сохранении конфигурации."))
+		return
+	}
+	if err := b.verifyAdmins(); err != nil {
+		log.Printf("Error updating admin statuses: %v", err)
+	}
+
+	action := models.AuditDemote
+	if promote {
+		action = models.AuditPromote
+	}
+	b.audit(message.From.ID, action, userID, name)
+
+	text := fmt.Sprintf("✅ %s больше не администратор.", name)
+	if promote {
+		text = fmt.Sprintf("✅ %s назначен администратором.", name)
+		if target == nil {
+			text += " Права появятся, когда пользователь напишет боту."
+		}
+	}
+	b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+}
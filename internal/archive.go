@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Largest document a bot may upload to Telegram
+const maxUploadSize = 50 * 1024 * 1024
+
+// archiveName is the name of a file inside a ZIP archive. The file ID
+// keeps names unique when a user uploaded several files with the same name.
+func archiveName(file *models.File) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, file.FileName)
+	if name == "" {
+		name = "file"
+	}
+	return fmt.Sprintf("%d_%s", file.ID, name)
+}
+
+// writeFilesZip writes the files and a manifest.csv describing them to a ZIP archive.
+// extra holds additional entries by name, such as a profile export.
+func writeFilesZip(w io.Writer, files []*models.File, extra map[string][]byte) error {
+	archive := zip.NewWriter(w)
+
+	for name, data := range extra {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := archive.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	rows := csv.NewWriter(manifest)
+	rows.Write([]string{"file_id", "archive_name", "file_name", "file_type", "size", "created_at", "team"})
+	for _, file := range files {
+		rows.Write([]string{
+			fmt.Sprint(file.ID), archiveName(file), file.FileName, file.FileType,
+			fmt.Sprint(file.Size), file.CreatedAt.Format(time.RFC3339), file.Team,
+		})
+	}
+	rows.Flush()
+	if err := rows.Error(); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		header := &zip.FileHeader{Name: archiveName(file), Method: zip.Deflate, Modified: file.CreatedAt}
+		entry, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(file.FileData); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// saveFilesZip writes a ZIP archive of the files to the export directory and returns its path
+func (b *Bot) saveFilesZip(name string, files []*models.File, extra map[string][]byte) (string, error) {
+	if err := os.MkdirAll(b.Config.ExportDir, 0o750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(b.Config.ExportDir, name)
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFilesZip(out, files, extra); err != nil {
+		out.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// removeUserArchives deletes the offboarding and /mydata archives of a user left in the export directory
+func (b *Bot) removeUserArchives(userID int64) error {
+	for _, prefix := range []string{"offboarding", "mydata"} {
+		paths, err := filepath.Glob(filepath.Join(b.Config.ExportDir, fmt.Sprintf("%s_%d_*.zip", prefix, userID)))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendArchive sends a saved archive as a document, or tells where it lies when
+// it is too large for Telegram. It reports whether the archive was delivered.
+func (b *Bot) sendArchive(chatID int64, path, caption string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Error reading archive: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при чтении архива."))
+		return false
+	}
+	if info.Size() > maxUploadSize {
+		b.send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s\nАрхив слишком большой для Telegram (%s) и сохранен на сервере: %s",
+			caption, humanSize(info.Size()), path)))
+		return false
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+	doc.Caption = caption
+	if _, err := b.send(doc); err != nil {
+		log.Printf("Error sending archive: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось отправить архив, он сохранен на сервере: %s", path)))
+		return false
+	}
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"telegram-bot/config"
 	"telegram-bot/db"
 	"telegram-bot/models"
@@ -21,12 +22,72 @@ type Bot struct {
 	DB            *db.DB
 	Config        *config.Config
 	SheetsService *SheetsService
+
+	sinks      []ReportSink
+	limiter    *RateLimiter
+	outgoing   *outgoingLimiter
+	outboxWake chan struct{}
+
+	// Dialogs waiting for the user's next message, by user ID
+	dialogs   map[int64]string
+	dialogsMu sync.Mutex
+
+	// Rate limit pauses of sinks, used only by the outbox worker
+	sinkBackoff     map[string]time.Duration
+	sinkPausedUntil map[string]time.Time
 }
 
-// verifyAdmins checks and updates admin status for all users in the database
+// verifyAdmins checks and updates admin status and configured roles for all users in the database
 func (b *Bot) verifyAdmins() error {
 	// Update all admin statuses at once using the config
-	return b.DB.UpdateAdminStatuses(b.Config.Admins)
+	if err := b.DB.UpdateAdminStatuses(b.Config.AdminList()); err != nil {
+		return err
+	}
+
+	for userID, role := range b.Config.Roles {
+		if err := b.DB.SetUserRole(userID, role); err != nil {
+			return fmt.Errorf("failed to set role of user %d: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// migrateLegacyAdmins moves admins listed by username in the config to user IDs.
+// It runs once at startup and looks only at users already registered, so a new
+// account that takes a freed username never becomes an admin. A username is
+// resolved only when exactly one registered user has it.
+func (b *Bot) migrateLegacyAdmins() {
+	resolved := false
+	for _, username := range b.Config.LegacyAdmins() {
+		users, err := b.DB.FindUsersByUsername(strings.TrimPrefix(username, "@"))
+		if err != nil {
+			log.Printf("Error resolving admin %s: %v", username, err)
+			continue
+		}
+
+		switch len(users) {
+		case 0:
+			log.Printf("Warning: admin %s from the config matches no registered user and is ignored; "+
+				"grant the rights with /promote <ID> or list the ID in admin_ids", username)
+		case 1:
+			log.Printf("Admin %s from the config resolved to user ID %d", username, users[0].ID)
+			b.Config.ResolveLegacyAdmin(username, users[0].ID)
+			resolved = true
+		default:
+			ids := make([]string, len(users))
+			for i, user := range users {
+				ids[i] = strconv.FormatInt(user.ID, 10)
+			}
+			log.Printf("Warning: admin %s from the config matches several users (%s) and is ignored; "+
+				"list the right one in admin_ids", username, strings.Join(ids, ", "))
+		}
+	}
+
+	if resolved && b.Config.Path != "" {
+		if err := config.SaveConfig(b.Config, b.Config.Path); err != nil {
+			log.Printf("Error saving config after resolving admins: %v", err)
+		}
+	}
 }
 
 // NewBot creates a new Bot instance
@@ -37,11 +98,14 @@ func NewBot(botToken string, database *db.DB, cfg *config.Config) (*Bot, error)
 	}
 
 	// Инициализация Google Sheets API
-	sheetsService, err := NewSheetsService("config/credentials.json")
+	sheetsService, err := NewSheetsService(cfg.Sheets, database)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize Google Sheets API: %v", err)
 		// Продолжаем без Google Sheets
 		sheetsService = nil
+	} else {
+		// Ссылки на файлы в таблице открывают их в боте
+		sheetsService.SetBotUsername(api.Self.UserName)
 	}
 
 	bot := &Bot{
@@ -49,13 +113,34 @@ func NewBot(botToken string, database *db.DB, cfg *config.Config) (*Bot, error)
 		DB:            database,
 		Config:        cfg,
 		SheetsService: sheetsService,
+		sinks:         newReportSinks(cfg, sheetsService),
+		limiter:       NewRateLimiter(cfg.RateLimits),
+		outgoing:      newOutgoingLimiter(),
+		outboxWake:    make(chan struct{}, 1),
+
+		dialogs:         make(map[int64]string),
+		sinkBackoff:     make(map[string]time.Duration),
+		sinkPausedUntil: make(map[string]time.Time),
 	}
 
 	// Verify admin statuses at startup
+	bot.migrateLegacyAdmins()
 	if err := bot.verifyAdmins(); err != nil {
 		return nil, fmt.Errorf("failed to verify admins: %w", err)
 	}
 
+	// Phone numbers saved by older versions are stored as shared
+	if err := bot.normalizeStoredPhones(); err != nil {
+		log.Printf("Error normalizing phone numbers: %v", err)
+	}
+
+	// Files saved before their size was recorded would count as empty
+	if n, err := database.BackfillFileSizes(); err != nil {
+		log.Printf("Error backfilling file sizes: %v", err)
+	} else if n > 0 {
+		log.Printf("Recorded the size of %d stored files", n)
+	}
+
 	return bot, nil
 }
 
@@ -66,6 +151,29 @@ func (b *Bot) Start() error {
 
 	updates := b.API.GetUpdatesChan(u)
 
+	// Expose metrics for monitoring
+	if b.Config.MetricsAddr != "" {
+		go serveMetrics(b.Config.MetricsAddr)
+	}
+
+	// Deliver queued report events in the background
+	go b.runOutboxWorker()
+
+	// Periodically reconcile the sheet with stored files
+	if b.SheetsService != nil && b.Config.Sheets.ReconcileIntervalMinutes > 0 {
+		go b.runReconcileJob(time.Duration(b.Config.Sheets.ReconcileIntervalMinutes) * time.Minute)
+	}
+
+	// Keep the summary and employees sheets up to date
+	if b.SheetsService != nil && (b.Config.Sheets.SummarySheetName != "" || b.Config.Sheets.EmployeesSheetName != "") {
+		go b.runSummaryJob(time.Duration(b.Config.Sheets.SummaryIntervalMinutes) * time.Minute)
+	}
+
+	// Apply review decisions that managers make in the sheet
+	if b.SheetsService != nil && b.SheetsService.HasReviewColumn() && b.Config.Sheets.ReviewPollIntervalMinutes > 0 {
+		go b.runReviewPoller(time.Duration(b.Config.Sheets.ReviewPollIntervalMinutes) * time.Minute)
+	}
+
 	for update := range updates {
 		// Handle different types of updates
 		if update.Message != nil {
@@ -83,13 +191,19 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 	// Log message to console
 	log.Printf("[%s] %s", message.From.UserName, message.Text)
 
+	// Group chats are handled separately: no onboarding, commands and attachments only
+	if !message.Chat.IsPrivate() {
+		b.handleGroupMessage(message)
+		return
+	}
+
 	// Save user info to database
 	user := &models.User{
 		ID:        message.From.ID,
 		Username:  message.From.UserName,
 		FirstName: message.From.FirstName,
 		LastName:  message.From.LastName,
-		IsAdmin:   b.Config.IsAdmin(message.From.UserName),
+		IsAdmin:   b.Config.IsAdmin(message.From.ID),
 	}
 
 	// Check if user exists in the database
@@ -98,28 +212,76 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		log.Printf("Error getting user: %v", err)
 	}
 
+	// Banned and offboarded users get nothing but a notice
+	if existingUser != nil && existingUser.Blocked() {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, bannedText))
+		return
+	}
+
+	// A user who writes to the bot again has unblocked it
+	if existingUser != nil && !existingUser.IsActive {
+		if err := b.DB.SetUserActive(user.ID, true); err != nil {
+			log.Printf("Error updating user activity: %v", err)
+		}
+	}
+
+	// Remember when the user was last seen; new users get it on registration
+	if existingUser != nil {
+		if err := b.DB.TouchUser(user.ID); err != nil {
+			log.Printf("Error updating last seen time: %v", err)
+		}
+	}
+
 	// If user does not exist, save to DB and request phone number
 	if existingUser == nil {
+		// With restricted registration, new users need a whitelisted phone or an invite
+		user.Approved = !b.Config.Registration.Restricted || user.IsAdmin
 		if err := b.DB.SaveUser(user); err != nil {
 			log.Printf("Error saving user: %v", err)
 		}
+		// A role from the config may be waiting for this user
+		if b.Config.Roles[user.ID] != "" {
+			if err := b.verifyAdmins(); err != nil {
+				log.Printf("Error verifying admins: %v", err)
+			}
+		}
+		if !user.Approved && isInviteStart(message) {
+			b.handleUnapproved(message, user)
+			return
+		}
 		b.requestPhoneNumber(message.Chat.ID)
 		return
 	}
 
 	// If user exists but doesn't have a phone number yet
 	if existingUser.Phone == "" {
-		// If this message contains a contact, save the phone number
+		// If this message contains the user's own contact, save the phone number
 		if message.Contact != nil {
-			phone := message.Contact.PhoneNumber
+			if !ownContact(message) {
+				b.sendForeignContact(message.Chat.ID)
+				return
+			}
+
+			phone := contactPhone(message.Contact)
 			if err := b.DB.UpdateUserPhone(user.ID, phone); err != nil {
 				log.Printf("Error updating phone: %v", err)
 			}
 
+			// Users who are not approved yet must be on the whitelist
+			if !existingUser.Approved && !b.checkPhone(message, phone) {
+				return
+			}
+
 			// Remove keyboard and send confirmation
 			msg := tgbotapi.NewMessage(message.Chat.ID, "Спасибо! Ваш номер телефона сохранен.")
 			msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-			b.API.Send(msg)
+			b.send(msg)
+			return
+		}
+
+		// An invite link may be opened before the phone number is shared
+		if !existingUser.Approved && isInviteStart(message) && b.allowAction(message) {
+			b.handleUnapproved(message, existingUser)
 			return
 		}
 
@@ -128,10 +290,44 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
+	// Users outside the whitelist can only enter an invite code or employee ID
+	if !existingUser.Approved {
+		if b.allowAction(message) {
+			b.handleUnapproved(message, existingUser)
+		}
+		return
+	}
+
+	// Check the user's rate limit before doing any work
+	if !b.allowAction(message) {
+		return
+	}
+
+	// A dialog such as a phone change takes the next message
+	if b.handleDialog(message) {
+		return
+	}
+
 	// Handle different types of media
+	if b.handleAttachment(message) {
+		return
+	}
+
+	// Handle commands
+	if message.IsCommand() {
+		b.handleCommand(message)
+		return
+	}
+
+	// Process regular messages
+	b.processMessage(message)
+}
+
+// handleAttachment saves a file attached to the message and reports whether there was one
+func (b *Bot) handleAttachment(message *tgbotapi.Message) bool {
 	if message.Document != nil {
 		b.handleFileUpload(message, message.Document.FileID, message.Document.FileName, message.Document.MimeType)
-		return
+		return true
 	}
 
 	if message.Photo != nil {
@@ -143,13 +339,13 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 		} else {
 			b.handleFileUpload(message, photo.FileID, "photo.jpg", "image/jpeg")
 		}
-		return
+		return true
 	}
 
 	if message.Voice != nil {
 		// Handle voice message
 		b.handleFileUpload(message, message.Voice.FileID, "voice.ogg", "audio/ogg")
-		return
+		return true
 	}
 
 	if message.Audio != nil {
@@ -159,7 +355,7 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 			fileName = "audio.mp3"
 		}
 		b.handleFileUpload(message, message.Audio.FileID, fileName, "audio/mpeg")
-		return
+		return true
 	}
 
 	if message.Video != nil {
@@ -174,23 +370,16 @@ func (b *Bot) handleMessage(message *tgbotapi.Message) {
 			}
 		}
 		b.handleFileUpload(message, message.Video.FileID, fileName, "video/mp4")
-		return
+		return true
 	}
 
 	if message.VideoNote != nil {
 		// Handle video note (circular video)
 		b.handleFileUpload(message, message.VideoNote.FileID, "video_note.mp4", "video/mp4")
-		return
-	}
-
-	// Handle commands
-	if message.IsCommand() {
-		b.handleCommand(message)
-		return
+		return true
 	}
 
-	// Process regular messages
-	b.processMessage(message)
+	return false
 }
 
 // requestPhoneNumber asks the user for their phone number
@@ -204,7 +393,7 @@ func (b *Bot) requestPhoneNumber(chatID int64) {
 	msg := tgbotapi.NewMessage(chatID, "Пожалуйста, поделитесь своим номером телефона.")
 	msg.ReplyMarkup = keyboard
 
-	b.API.Send(msg)
+	b.send(msg)
 }
 
 // processMessage processes regular messages
@@ -216,16 +405,20 @@ func (b *Bot) processMessage(message *tgbotapi.Message) {
 		return
 	}
 
-	// Check if admin
+	// Describe the user's role
 	statusText := "обычный пользователь"
 	if user.IsAdmin {
 		statusText = "администратор"
+	} else if role, err := b.DB.GetRole(user.Role); err != nil {
+		log.Printf("Error getting role: %v", err)
+	} else if role != nil {
+		statusText = role.Title
 	}
 
 	responseText := fmt.Sprintf("Ваше сообщение получено, %s.\nВаш статус: %s", user.FirstName, statusText)
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
-	b.API.Send(msg)
+	b.send(msg)
 }
 
 // handleCallback handles callback queries from inline keyboards
@@ -233,6 +426,14 @@ func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
 	// Handle any callback queries here
 	log.Printf("[CALLBACK] %s: %s", callback.From.UserName, callback.Data)
 
+	// Blocked users cannot confirm actions offered before the ban
+	if user, err := b.DB.GetUser(callback.From.ID); err != nil {
+		log.Printf("Error getting user: %v", err)
+	} else if user != nil && user.Blocked() {
+		b.API.Request(tgbotapi.NewCallback(callback.ID, bannedText))
+		return
+	}
+
 	// Handle delete confirmation
 	if strings.HasPrefix(callback.Data, "confirm_delete_") {
 		if callback.Data == "confirm_delete_all" {
@@ -242,57 +443,74 @@ func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
 			if err != nil {
 				log.Printf("Error deleting files: %v", err)
 				msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Ошибка при удалении файлов.")
-				b.API.Send(msg)
+				b.send(msg)
 				return
 			}
 
-			// Обновляем статус всех файлов пользователя в Google Sheets
-			if b.SheetsService != nil {
-				err := b.SheetsService.MarkAllFilesAsDeleted(callback.From.ID)
-				if err != nil {
-					log.Printf("Error updating file statuses in Google Sheets: %v", err)
-					// Продолжаем выполнение, даже если обновление статусов не удалось
-				} else {
-					log.Printf("All files marked as deleted for user %d in Google Sheets", callback.From.ID)
-				}
-			}
+			// Сообщаем об удалении в отчеты
+			b.report(&ReportEvent{
+				Type:     EventDeleteAll,
+				Time:     time.Now(),
+				UserID:   callback.From.ID,
+				Username: b.ownerUsername(callback.From.ID),
+			})
 
 			msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Все ваши файлы успешно удалены.")
-			b.API.Send(msg)
+			b.send(msg)
 		} else {
 			// Handle delete single file
 			fileID, _ := strconv.ParseInt(strings.TrimPrefix(callback.Data, "confirm_delete_"), 10, 64)
 
+			// Keep the file details for the report
+			file, err := b.DB.GetFileInfo(fileID)
+			if err != nil {
+				log.Printf("Error getting file: %v", err)
+			}
+			if file == nil {
+				file = &models.File{ID: fileID, UserID: callback.From.ID}
+			}
+
+			// Callback data comes from the client, so the rights are checked again
+			a, err := b.accessFor(callback.From.ID)
+			if err != nil {
+				log.Printf("Error checking access: %v", err)
+			}
+			if a == nil || !a.canDelete(file) {
+				msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "У вас нет прав для удаления этого файла.")
+				b.send(msg)
+				return
+			}
+
 			// Delete file
-			err := b.DB.DeleteFile(fileID)
+			err = b.DB.DeleteFile(fileID)
 			if err != nil {
 				log.Printf("Error deleting file: %v", err)
 				msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Ошибка при удалении файла.")
-				b.API.Send(msg)
+				b.send(msg)
 				return
 			}
 
-			// Обновляем статус файла в Google Sheets
-			if b.SheetsService != nil {
-				err := b.SheetsService.UpdateFileStatus(fileID, FileStatusDeleted)
-				if err != nil {
-					log.Printf("Error updating file status in Google Sheets: %v", err)
-					// Продолжаем выполнение, даже если обновление статуса не удалось
-				} else {
-					log.Printf("File %d marked as deleted in Google Sheets", fileID)
-				}
-			}
+			// Сообщаем об удалении в отчеты
+			b.report(fileEvent(EventDelete, file, b.ownerUsername(file.UserID)))
 
 			msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Файл успешно удален.")
-			b.API.Send(msg)
+			b.send(msg)
 		}
+	} else if callback.Data == callbackConfirmErasure || callback.Data == callbackCancelErasure ||
+		strings.HasPrefix(callback.Data, callbackApproveErasure) || strings.HasPrefix(callback.Data, callbackRejectErasure) {
+		b.handleErasureCallback(callback)
+	} else if strings.HasPrefix(callback.Data, callbackConfirmOffboard) {
+		b.handleOffboardCallback(callback)
+	} else if callback.Data == callbackCancelOffboard {
+		msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Увольнение отменено.")
+		b.send(msg)
 	} else if strings.HasPrefix(callback.Data, "cancel_delete_") {
 		if callback.Data == "cancel_delete_all" {
 			msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Удаление файлов отменено.")
-			b.API.Send(msg)
+			b.send(msg)
 		} else {
 			msg := tgbotapi.NewMessage(callback.Message.Chat.ID, "Удаление файла отменено.")
-			b.API.Send(msg)
+			b.send(msg)
 		}
 	}
 
@@ -305,9 +523,8 @@ func (b *Bot) handleFileUpload(message *tgbotapi.Message, fileID, fileName, file
 	var fileBytes []byte
 	var err error
 
-	// Send loading message
-	loadingMsg := tgbotapi.NewMessage(message.Chat.ID, "⏳ Файл загружается в базу данных, пожалуйста, подождите...")
-	b.API.Send(loadingMsg)
+	// One status message is edited through all stages of the upload
+	status := b.startUploadStatus(message.Chat.ID)
 
 	// First try to get file info from Telegram API
 	fileConfig := tgbotapi.FileConfig{FileID: fileID}
@@ -320,8 +537,7 @@ func (b *Bot) handleFileUpload(message *tgbotapi.Message, fileID, fileName, file
 		resp, err := http.Get(fileURL)
 		if err != nil {
 			log.Printf("Error downloading file via alternative method: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файла.")
-			b.API.Send(msg)
+			status.finish("❌ Ошибка при получении файла.")
 			return
 		}
 		defer resp.Body.Close()
@@ -332,32 +548,28 @@ func (b *Bot) handleFileUpload(message *tgbotapi.Message, fileID, fileName, file
 			// If we got JSON response, it's probably an error
 			body, _ := io.ReadAll(resp.Body)
 			log.Printf("Received JSON response instead of file: %s", string(body))
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файла.")
-			b.API.Send(msg)
+			status.finish("❌ Ошибка при получении файла.")
 			return
 		}
 
 		// Check file size
 		if resp.ContentLength > 100*1024*1024 { // 100MB
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Извините, файл слишком большой. Максимальный размер файла - 100 МБ.")
-			b.API.Send(msg)
+			status.finish("❌ Извините, файл слишком большой. Максимальный размер файла - 100 МБ.")
 			return
 		}
 
 		// Read file data
-		fileBytes, err = io.ReadAll(resp.Body)
+		fileBytes, err = io.ReadAll(&progressReader{r: resp.Body, total: resp.ContentLength, onProgress: status.progress})
 		if err != nil {
 			log.Printf("Error reading file: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при чтении файла.")
-			b.API.Send(msg)
+			status.finish("❌ Ошибка при чтении файла.")
 			return
 		}
 	} else {
 		// Check file size (100MB limit)
 		const maxFileSize = 100 * 1024 * 1024 // 100MB in bytes
 		if fileData.FileSize > maxFileSize {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Извините, файл слишком большой. Максимальный размер файла - 100 МБ.")
-			b.API.Send(msg)
+			status.finish("❌ Извините, файл слишком большой. Максимальный размер файла - 100 МБ.")
 			return
 		}
 
@@ -366,18 +578,16 @@ func (b *Bot) handleFileUpload(message *tgbotapi.Message, fileID, fileName, file
 		resp, err := http.Get(fileURL)
 		if err != nil {
 			log.Printf("Error downloading file: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при скачивании файла.")
-			b.API.Send(msg)
+			status.finish("❌ Ошибка при скачивании файла.")
 			return
 		}
 		defer resp.Body.Close()
 
 		// Read file data
-		fileBytes, err = io.ReadAll(resp.Body)
+		fileBytes, err = io.ReadAll(&progressReader{r: resp.Body, total: int64(fileData.FileSize), onProgress: status.progress})
 		if err != nil {
 			log.Printf("Error reading file: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при чтении файла.")
-			b.API.Send(msg)
+			status.finish("❌ Ошибка при чтении файла.")
 			return
 		}
 	}
@@ -388,46 +598,39 @@ func (b *Bot) handleFileUpload(message *tgbotapi.Message, fileID, fileName, file
 		FileName:  fileName,
 		FileType:  fileType,
 		FileData:  fileBytes,
+		Size:      int64(len(fileBytes)),
 		CreatedAt: time.Now(),
 	}
 
+	// Files uploaded in a team channel are tagged with the group
+	if !message.Chat.IsPrivate() {
+		dbFile.ChatID = message.Chat.ID
+		dbFile.Team = message.Chat.Title
+	}
+
 	// Save file to database
+	status.update("💾 Сохранение файла...")
 	err = b.DB.SaveFile(dbFile)
 	if err != nil {
 		if err.Error() == "file already exists" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Этот файл уже был загружен ранее.")
-			b.API.Send(msg)
+			status.finish("ℹ️ Этот файл уже был загружен ранее.")
 			return
 		}
 		log.Printf("Error saving file: %v", err)
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при сохранении файла.")
-		b.API.Send(msg)
+		status.finish("❌ Ошибка при сохранении файла.")
 		return
 	}
 
-	// Log file upload to Google Sheets if service is available
-	if b.SheetsService != nil {
-		username := message.From.UserName
-		if username == "" {
-			username = fmt.Sprintf("%s %s", message.From.FirstName, message.From.LastName)
-		}
-
-		err := b.SheetsService.LogFileUpload(dbFile, username)
-		if err != nil {
-			log.Printf("Error logging to Google Sheets: %v", err)
-			// Продолжаем выполнение, даже если запись в Google Sheets не удалась
-		} else {
-			log.Printf("File upload logged to Google Sheets: ID=%d, User=%s", dbFile.ID, username)
-		}
-
-		// Добавляем задержку в 1 секунду, чтобы дать Google Sheets время обновиться
-		time.Sleep(1 * time.Second)
+	// Queue the report records; the user is confirmed as soon as the file is stored
+	username := message.From.UserName
+	if username == "" {
+		username = fmt.Sprintf("%s %s", message.From.FirstName, message.From.LastName)
 	}
+	b.report(fileEvent(EventUpload, dbFile, username))
 
-	// Send confirmation with file ID
-	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ Файл успешно сохранен.\nID файла: %d\nИмя файла: %s\nТип файла: %s",
+	// Show confirmation with file ID
+	status.finish(fmt.Sprintf("✅ Файл успешно сохранен.\nID файла: %d\nИмя файла: %s\nТип файла: %s",
 		dbFile.ID, dbFile.FileName, dbFile.FileType))
-	b.API.Send(msg)
 }
 
 // handleCommand handles bot commands
@@ -437,6 +640,12 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 
 	switch command {
 	case "start":
+		// Deep links from the report spreadsheet: t.me/<bot>?start=show_<id>
+		if fileID, ok := strings.CutPrefix(args, startPayloadShow); ok {
+			b.handleShowCommand(message, fileID)
+			return
+		}
+
 		helpText := `Добро пожаловать! Я бот для хранения и управления файлами.
 
 Доступные команды:
@@ -444,6 +653,14 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 /show <id> - показать файл по его ID
 /delete <id> - удалить файл по его ID
 /deleteall - удалить все ваши файлы
+/phone - изменить номер телефона
+/profile - должность, табельный номер, email, отдел и дата приема
+/mydata - получить все ваши данные и файлы архивом (/mydata erase - запросить их удаление)
+/setrole @user <роль> - назначить роль (для управляющих пользователями)
+/promote @user, /demote @user - назначить или снять администратора (для администраторов)
+/invite - создать приглашение для нового сотрудника (для управляющих пользователями)
+/users, /user @user, /ban @user, /unban @user - управление пользователями
+/offboard @user - оформить увольнение сотрудника с передачей его файлов
 
 Ограничения:
 - Максимальный размер файла: 100 МБ
@@ -452,70 +669,26 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 Для начала работы просто отправьте мне любой файл!`
 
 		msg := tgbotapi.NewMessage(message.Chat.ID, helpText)
-		b.API.Send(msg)
+		b.send(msg)
 
 	case "list":
-		// Get user's files
-		files, err := b.DB.GetUserFiles(message.From.ID)
-		if err != nil {
-			log.Printf("Error getting user files: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка файлов.")
-			b.API.Send(msg)
-			return
-		}
-
-		// If user is admin, get all files
-		user, err := b.DB.GetUser(message.From.ID)
-		if err != nil {
-			log.Printf("Error getting user: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
-			b.API.Send(msg)
-			return
-		}
-
-		if user.IsAdmin {
-			// Get all files from all users
-			allFiles, err := b.DB.GetAllFiles()
-			if err != nil {
-				log.Printf("Error getting all files: %v", err)
-				msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка файлов.")
-				b.API.Send(msg)
-				return
-			}
-			files = allFiles
-		}
-
-		if len(files) == 0 {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет доступных файлов.")
-			b.API.Send(msg)
-			return
-		}
-
-		// Format file list
-		var response strings.Builder
-		for i, file := range files {
-			response.WriteString(fmt.Sprintf("%d. %s (ID: %d)\n", i+1, file.FileName, file.ID))
-		}
-
-		msg := tgbotapi.NewMessage(message.Chat.ID, response.String())
-		b.API.Send(msg)
+		b.handleListCommand(message, args)
 
 	case "show":
+		b.handleShowCommand(message, args)
+
+	case "delete":
 		if args == "" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Пожалуйста, укажите ID файла. Например: /show 1")
-			b.API.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Пожалуйста, укажите ID файла. Например: /delete 1")
+			b.send(msg)
 			return
 		}
 
-		// Send immediate response
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Ожидайте загрузки файла...")
-		b.API.Send(msg)
-
 		var fileID int64
 		_, err := fmt.Sscanf(args, "%d", &fileID)
 		if err != nil {
 			msg := tgbotapi.NewMessage(message.Chat.ID, "Неверный формат ID файла.")
-			b.API.Send(msg)
+			b.send(msg)
 			return
 		}
 
@@ -524,109 +697,108 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 		if err != nil {
 			log.Printf("Error getting file: %v", err)
 			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файла.")
-			b.API.Send(msg)
+			b.send(msg)
 			return
 		}
 
 		if file == nil {
 			msg := tgbotapi.NewMessage(message.Chat.ID, "Файл не найден.")
-			b.API.Send(msg)
+			b.send(msg)
 			return
 		}
 
 		// Check permissions
-		user, err := b.DB.GetUser(message.From.ID)
+		a, err := b.accessFor(message.From.ID)
 		if err != nil {
-			log.Printf("Error getting user: %v", err)
+			log.Printf("Error checking access: %v", err)
 			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
-			b.API.Send(msg)
+			b.send(msg)
 			return
 		}
 
-		if !user.IsAdmin && file.UserID != message.From.ID {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет прав для доступа к этому файлу.")
-			b.API.Send(msg)
+		if !a.canDelete(file) {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет прав для удаления этого файла.")
+			b.send(msg)
 			return
 		}
 
-		// Create file bytes with proper name and type
-		fileBytes := tgbotapi.FileBytes{
-			Name:  file.FileName,
-			Bytes: file.FileData,
-		}
+		// Create inline keyboard for confirmation
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("confirm_delete_%d", fileID)),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", fmt.Sprintf("cancel_delete_%d", fileID)),
+			),
+		)
 
-		// Send file based on its type
-		switch {
-		case strings.HasPrefix(file.FileType, "image/"):
-			photo := tgbotapi.NewPhoto(message.Chat.ID, fileBytes)
-			b.API.Send(photo)
-		case strings.HasPrefix(file.FileType, "video/"):
-			video := tgbotapi.NewVideo(message.Chat.ID, fileBytes)
-			b.API.Send(video)
-		case strings.HasPrefix(file.FileType, "audio/"):
-			audio := tgbotapi.NewAudio(message.Chat.ID, fileBytes)
-			b.API.Send(audio)
-		default:
-			doc := tgbotapi.NewDocument(message.Chat.ID, fileBytes)
-			b.API.Send(doc)
-		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Вы уверены, что хотите удалить файл %s?", file.FileName))
+		msg.ReplyMarkup = keyboard
+		b.send(msg)
 
-	case "delete":
-		if args == "" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Пожалуйста, укажите ID файла. Например: /delete 1")
-			b.API.Send(msg)
-			return
-		}
+	case "groups":
+		b.listGroups(message)
 
-		var fileID int64
-		_, err := fmt.Sscanf(args, "%d", &fileID)
-		if err != nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Неверный формат ID файла.")
-			b.API.Send(msg)
-			return
-		}
+	case "setrole":
+		b.handleSetRoleCommand(message)
 
-		// Get file from database
-		file, err := b.DB.GetFile(fileID)
-		if err != nil {
-			log.Printf("Error getting file: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файла.")
-			b.API.Send(msg)
-			return
-		}
+	case "invite":
+		b.handleInviteCommand(message)
 
-		if file == nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Файл не найден.")
-			b.API.Send(msg)
+	case "users":
+		b.handleUsersCommand(message)
+
+	case "user":
+		b.handleUserCommand(message)
+
+	case "ban":
+		b.handleBanCommand(message)
+
+	case "unban":
+		b.handleUnbanCommand(message)
+
+	case "offboard":
+		b.handleOffboardCommand(message)
+
+	case "phone":
+		user, err := b.DB.GetUser(message.From.ID)
+		if err != nil || user == nil {
+			log.Printf("Error getting user: %v", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении профиля.")
+			b.send(msg)
 			return
 		}
+		b.handlePhoneCommand(message, user)
 
-		// Check permissions
+	case "profile":
 		user, err := b.DB.GetUser(message.From.ID)
-		if err != nil {
+		if err != nil || user == nil {
 			log.Printf("Error getting user: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
-			b.API.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении профиля.")
+			b.send(msg)
 			return
 		}
+		b.handleProfileCommand(message, user)
 
-		if !user.IsAdmin && file.UserID != message.From.ID {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет прав для удаления этого файла.")
-			b.API.Send(msg)
+	case "mydata":
+		user, err := b.DB.GetUser(message.From.ID)
+		if err != nil || user == nil {
+			log.Printf("Error getting user: %v", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении профиля.")
+			b.send(msg)
 			return
 		}
+		b.handleMyDataCommand(message, user)
 
-		// Create inline keyboard for confirmation
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("confirm_delete_%d", fileID)),
-				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", fmt.Sprintf("cancel_delete_%d", fileID)),
-			),
-		)
+	case "promote":
+		b.handleAdminChange(message, true)
 
-		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Вы уверены, что хотите удалить файл %s?", file.FileName))
-		msg.ReplyMarkup = keyboard
-		b.API.Send(msg)
+	case "demote":
+		b.handleAdminChange(message, false)
+
+	case "reconcile":
+		b.handleReconcileCommand(message)
+
+	case "outbox":
+		b.handleOutboxCommand(message)
 
 	case "deleteall":
 		// Create inline keyboard for confirmation
@@ -639,10 +811,231 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 
 		msg := tgbotapi.NewMessage(message.Chat.ID, "Вы уверены, что хотите удалить все ваши файлы? Это действие нельзя отменить.")
 		msg.ReplyMarkup = keyboard
-		b.API.Send(msg)
+		b.send(msg)
 
 	default:
 		msg := tgbotapi.NewMessage(message.Chat.ID, "Извините, такой команды не существует. Используйте /start для получения списка доступных команд.")
-		b.API.Send(msg)
+		b.send(msg)
+	}
+}
+
+// handleListCommand sends the list of files the user may see: their own and their
+// reports', their team channels' or all files, depending on the role.
+// "group:<id>" and "dept:<name>" narrow the list to one group or department.
+func (b *Bot) handleListCommand(message *tgbotapi.Message, args string) {
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
+		b.send(msg)
+		return
+	}
+
+	var files []*models.File
+	switch {
+	case strings.HasPrefix(args, "group:"):
+		// Get files uploaded in a specific group
+		chatID, err := strconv.ParseInt(strings.TrimPrefix(args, "group:"), 10, 64)
+		if err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Неверный формат ID группы. Например: /list group:-1001234567890")
+			b.send(msg)
+			return
+		}
+		files, err = b.DB.GetGroupFilesInfo(chatID)
+		if err != nil {
+			log.Printf("Error getting group files: %v", err)
+		}
+	case strings.HasPrefix(args, "dept:"):
+		if !a.can(models.PermissionViewAll) {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Список файлов отдела доступен только пользователям с доступом ко всем файлам.")
+			b.send(msg)
+			return
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(args, "dept:"))
+		department, err := b.DB.GetDepartmentByName(name)
+		if err != nil {
+			log.Printf("Error getting department: %v", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении отдела.")
+			b.send(msg)
+			return
+		}
+		if department == nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Отдел «%s» не найден.", name))
+			b.send(msg)
+			return
+		}
+		files, err = b.departmentFiles(department.ID)
+		if err != nil {
+			log.Printf("Error getting department files: %v", err)
+		}
+	case a.can(models.PermissionViewAll):
+		files, err = b.DB.GetAllFilesInfo()
+		if err != nil {
+			log.Printf("Error getting all files: %v", err)
+		}
+	default:
+		files, err = b.relatedFiles(a)
+		if err != nil {
+			log.Printf("Error getting user files: %v", err)
+		}
+	}
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка файлов.")
+		b.send(msg)
+		return
+	}
+	files = a.filterVisible(files)
+
+	if len(files) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет доступных файлов.")
+		b.send(msg)
+		return
+	}
+
+	// Format file list
+	var response strings.Builder
+	for i, file := range files {
+		response.WriteString(fmt.Sprintf("%d. %s (ID: %d)\n", i+1, file.FileName, file.ID))
+	}
+
+	b.sendText(message.Chat.ID, response.String())
+}
+
+// relatedFiles returns the files of the user and their reports and, with the
+// view_team permission, the files of the team channels the user belongs to
+func (b *Bot) relatedFiles(a *access) ([]*models.File, error) {
+	files, err := b.DB.GetUsersFilesInfo(append(a.reportIDs(), a.user.ID))
+	if err != nil {
+		return nil, err
+	}
+	if !a.can(models.PermissionViewTeam) {
+		return files, nil
+	}
+
+	groups, err := b.DB.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool, len(files))
+	for _, file := range files {
+		seen[file.ID] = true
+	}
+	for _, group := range groups {
+		if !a.inChat(group.ChatID) {
+			continue
+		}
+		groupFiles, err := b.DB.GetGroupFilesInfo(group.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range groupFiles {
+			if !seen[file.ID] {
+				seen[file.ID] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// departmentFiles returns the files of all users of a department
+func (b *Bot) departmentFiles(departmentID int64) ([]*models.File, error) {
+	users, err := b.DB.GetDepartmentUsers(departmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return b.DB.GetUsersFilesInfo(ids)
+}
+
+// handleShowCommand sends a stored file to a user whose role allows seeing it
+func (b *Bot) handleShowCommand(message *tgbotapi.Message, args string) {
+	if args == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Пожалуйста, укажите ID файла. Например: /show 1")
+		b.send(msg)
+		return
+	}
+
+	// Send immediate response
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Ожидайте загрузки файла...")
+	b.send(msg)
+
+	var fileID int64
+	_, err := fmt.Sscanf(args, "%d", &fileID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Неверный формат ID файла.")
+		b.send(msg)
+		return
+	}
+
+	// Get file from database
+	file, err := b.DB.GetFile(fileID)
+	if err != nil {
+		log.Printf("Error getting file: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файла.")
+		b.send(msg)
+		return
+	}
+
+	if file == nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Файл не найден.")
+		b.send(msg)
+		return
+	}
+
+	// Check permissions
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
+		b.send(msg)
+		return
+	}
+
+	if !a.canView(file) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет прав для доступа к этому файлу.")
+		b.send(msg)
+		return
+	}
+
+	// In a group only files uploaded there are posted; any other file would reach
+	// every member, so it goes to the requester's private chat instead
+	chatID := message.Chat.ID
+	if !message.Chat.IsPrivate() && file.ChatID != message.Chat.ID {
+		chatID = message.From.ID
+	}
+
+	// Create file bytes with proper name and type
+	fileBytes := tgbotapi.FileBytes{
+		Name:  file.FileName,
+		Bytes: file.FileData,
+	}
+
+	// Send file based on its type
+	var send tgbotapi.Chattable
+	switch {
+	case strings.HasPrefix(file.FileType, "image/"):
+		send = tgbotapi.NewPhoto(chatID, fileBytes)
+	case strings.HasPrefix(file.FileType, "video/"):
+		send = tgbotapi.NewVideo(chatID, fileBytes)
+	case strings.HasPrefix(file.FileType, "audio/"):
+		send = tgbotapi.NewAudio(chatID, fileBytes)
+	default:
+		send = tgbotapi.NewDocument(chatID, fileBytes)
+	}
+	_, err = b.send(send)
+
+	if chatID != message.Chat.ID {
+		text := "Файл загружен не в этой группе, поэтому он отправлен вам в личные сообщения."
+		if err != nil {
+			text = "Файл загружен не в этой группе. Откройте его командой /show в личном чате с ботом."
+		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ReplyToMessageID = message.MessageID
+		b.send(msg)
 	}
 }
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Dialogs that wait for the user's next message
+const (
+	dialogPhone   = "phone"
+	dialogProfile = "profile"
+
+	// Waits for the value of a profile field: "profile:<field>"
+	dialogProfileField = "profile:"
+)
+
+// Reply keyboard button that ends a dialog
+const cancelButton = "Отмена"
+
+// setDialog makes the user's next message go to the dialog
+func (b *Bot) setDialog(userID int64, dialog string) {
+	b.dialogsMu.Lock()
+	defer b.dialogsMu.Unlock()
+	b.dialogs[userID] = dialog
+}
+
+// endDialog stops waiting for the user's reply
+func (b *Bot) endDialog(userID int64) {
+	b.dialogsMu.Lock()
+	defer b.dialogsMu.Unlock()
+	delete(b.dialogs, userID)
+}
+
+// handleDialog passes the message to the dialog the user is in and reports whether there was one.
+// A command or the cancel button ends the dialog; commands are then handled as usual.
+func (b *Bot) handleDialog(message *tgbotapi.Message) bool {
+	b.dialogsMu.Lock()
+	dialog := b.dialogs[message.From.ID]
+	b.dialogsMu.Unlock()
+	if dialog == "" {
+		return false
+	}
+
+	if message.IsCommand() {
+		b.endDialog(message.From.ID)
+		return false
+	}
+	if strings.TrimSpace(message.Text) == cancelButton {
+		b.endDialog(message.From.ID)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Отменено.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		b.send(msg)
+		return true
+	}
+
+	switch {
+	case dialog == dialogPhone:
+		b.handlePhoneDialog(message)
+	case dialog == dialogProfile:
+		b.handleProfileMenu(message)
+	case strings.HasPrefix(dialog, dialogProfileField):
+		b.handleProfileValue(message, strings.TrimPrefix(dialog, dialogProfileField))
+	}
+	return true
+}
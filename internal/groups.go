@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleGroupMessage handles messages from group and supergroup chats.
+// In groups the bot reacts only to commands and attachments.
+func (b *Bot) handleGroupMessage(message *tgbotapi.Message) {
+	if message.IsCommand() {
+		b.handleGroupCommand(message)
+		return
+	}
+
+	if !hasAttachment(message) {
+		return
+	}
+
+	// Only registered team channels accept uploads
+	group, err := b.DB.GetGroup(message.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting group: %v", err)
+		return
+	}
+	if group == nil {
+		return
+	}
+
+	if !b.allowAction(message) {
+		return
+	}
+
+	// Group members must complete onboarding in a private chat first
+	user, err := b.DB.GetUser(message.From.ID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return
+	}
+	if user != nil && user.Blocked() {
+		return
+	}
+	if user == nil || user.Phone == "" || !user.Approved {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Чтобы загружать файлы, сначала зарегистрируйтесь в личном чате с ботом.")
+		msg.ReplyToMessageID = message.MessageID
+		b.send(msg)
+		return
+	}
+
+	b.handleAttachment(message)
+}
+
+// handleGroupCommand handles bot commands sent in group chats
+func (b *Bot) handleGroupCommand(message *tgbotapi.Message) {
+	// Ignore commands addressed to other bots
+	if at := strings.Index(message.CommandWithAt(), "@"); at >= 0 {
+		if !strings.EqualFold(message.CommandWithAt()[at+1:], b.API.Self.UserName) {
+			return
+		}
+	}
+
+	if !b.allowAction(message) {
+		return
+	}
+
+	switch message.Command() {
+	case "start":
+		helpText := `Я бот для хранения отчетов команды.
+
+Команды в группе:
+/register_group - зарегистрировать группу как канал команды (для администраторов)
+/unregister_group - отменить регистрацию группы (для администраторов)
+/list - показать файлы, загруженные в этой группе
+/show <id> - показать файл по его ID
+/delete <id> - удалить файл по его ID
+
+Файлы, отправленные в зарегистрированную группу, сохраняются как отчеты команды.`
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, helpText)
+		b.send(msg)
+
+	case "register_group":
+		if !b.isAdminUser(message.From.ID) {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Регистрировать группы могут только администраторы.")
+			b.send(msg)
+			return
+		}
+
+		group := &models.Group{
+			ChatID:       message.Chat.ID,
+			Title:        message.Chat.Title,
+			Type:         message.Chat.Type,
+			RegisteredBy: message.From.ID,
+			CreatedAt:    time.Now(),
+		}
+		if err := b.DB.SaveGroup(group); err != nil {
+			log.Printf("Error saving group: %v", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при регистрации группы.")
+			b.send(msg)
+			return
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ Группа «%s» зарегистрирована как канал команды. Отправляйте сюда файлы отчетов.", group.Title))
+		b.send(msg)
+
+	case "unregister_group":
+		if !b.isAdminUser(message.From.ID) {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Отменять регистрацию групп могут только администраторы.")
+			b.send(msg)
+			return
+		}
+
+		if err := b.DB.DeleteGroup(message.Chat.ID); err != nil {
+			log.Printf("Error deleting group: %v", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при отмене регистрации группы.")
+			b.send(msg)
+			return
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Регистрация группы отменена. Файлы из этой группы больше не сохраняются.")
+		b.send(msg)
+
+	case "list":
+		b.listGroupFiles(message)
+
+	case "show", "delete":
+		user, err := b.DB.GetUser(message.From.ID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			return
+		}
+		if user != nil && user.Blocked() {
+			return
+		}
+		if user == nil || !user.Approved {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "Сначала зарегистрируйтесь в личном чате с ботом.")
+			msg.ReplyToMessageID = message.MessageID
+			b.send(msg)
+			return
+		}
+		b.handleCommand(message)
+	}
+}
+
+// listGroupFiles sends the list of files uploaded in the current group
+// that the member may see according to their role.
+func (b *Bot) listGroupFiles(message *tgbotapi.Message) {
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа.")
+		b.send(msg)
+		return
+	}
+
+	files, err := b.DB.GetGroupFilesInfo(message.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting group files: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка файлов.")
+		b.send(msg)
+		return
+	}
+	files = a.filterVisible(files)
+
+	if len(files) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "В этой группе нет доступных файлов.")
+		b.send(msg)
+		return
+	}
+
+	var response strings.Builder
+	for i, file := range files {
+		response.WriteString(fmt.Sprintf("%d. %s (ID: %d)\n", i+1, file.FileName, file.ID))
+	}
+
+	b.sendText(message.Chat.ID, response.String())
+}
+
+// listGroups sends the registered team channels with their file counts to an admin
+func (b *Bot) listGroups(message *tgbotapi.Message) {
+	if !b.isAdminUser(message.From.ID) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только администраторам.")
+		b.send(msg)
+		return
+	}
+
+	groups, err := b.DB.GetGroups()
+	if err != nil {
+		log.Printf("Error getting groups: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка групп.")
+		b.send(msg)
+		return
+	}
+
+	if len(groups) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Нет зарегистрированных групп.")
+		b.send(msg)
+		return
+	}
+
+	var response strings.Builder
+	for i, group := range groups {
+		count, err := b.DB.CountGroupFiles(group.ChatID)
+		if err != nil {
+			log.Printf("Error counting files for group %d: %v", group.ChatID, err)
+		}
+		response.WriteString(fmt.Sprintf("%d. %s (ID: %d), файлов: %d\n", i+1, group.Title, group.ChatID, count))
+	}
+	response.WriteString("\nСписок файлов группы: /list group:<ID>")
+
+	b.sendText(message.Chat.ID, response.String())
+}
+
+// hasAttachment reports whether the message carries a file the bot can store
+func hasAttachment(message *tgbotapi.Message) bool {
+	return message.Document != nil || message.Photo != nil || message.Voice != nil ||
+		message.Audio != nil || message.Video != nil || message.VideoNote != nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Payload of /start deep links that open a file: t.me/<bot>?start=show_<id>
+const startPayloadShow = "show_"
+
+// fileDeepLink returns a link that opens the file in the bot
+func fileDeepLink(botUsername string, fileID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%d", botUsername, startPayloadShow, fileID)
+}
+
+// profileLink returns a link to a Telegram profile by username
+func profileLink(username string) string {
+	return "https://t.me/" + strings.TrimPrefix(username, "@")
+}
+
+// hyperlinkFormula returns a spreadsheet HYPERLINK formula showing text
+func hyperlinkFormula(url, text string) string {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return fmt.Sprintf("=HYPERLINK(%s, %s)", quote(url), quote(text))
+}
+
+// humanSize formats a size in bytes for people: 512 Б, 1,5 КБ, 12,3 МБ
+func humanSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d Б", size)
+	}
+
+	units := []string{"КБ", "МБ", "ГБ", "ТБ"}
+	value := float64(size) / 1024
+	unit := 0
+	// A value that rounds up to 1024,0 moves to the next unit
+	for value >= 1023.95 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strings.Replace(fmt.Sprintf("%.1f %s", value, units[unit]), ".", ",", 1)
+}
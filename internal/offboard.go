@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telegram-bot/config"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Callback data of the offboarding confirmation: confirm_offboard_<user ID>_<new owner ID>
+const (
+	callbackConfirmOffboard = "confirm_offboard_"
+	callbackCancelOffboard  = "cancel_offboard"
+)
+
+// handleOffboardCommand starts offboarding of an employee who left:
+// /offboard <ID or @username> [<ID or @username of the new owner> | archive].
+// Without a new owner the user's manager and the archive owner are offered.
+// Nothing changes until the choice is confirmed with a button.
+func (b *Bot) handleOffboardCommand(message *tgbotapi.Message) {
+	if !b.requireManageUsers(message) {
+		return
+	}
+
+	user := b.commandTarget(message, "/offboard @username [@руководитель | archive]")
+	if user == nil {
+		return
+	}
+	if text := b.checkOffboard(message.From.ID, user); text != "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	// Candidates for the new owner of the files
+	type candidate struct {
+		id    int64
+		label string
+	}
+	var candidates []candidate
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 1 {
+		if args[1] == "archive" {
+			if b.Config.ArchiveUserID == 0 {
+				b.send(tgbotapi.NewMessage(message.Chat.ID, "Архивный владелец не задан: укажите archive_user_id в конфигурации."))
+				return
+			}
+			candidates = append(candidates, candidate{b.Config.ArchiveUserID, "📦 Передать в архив"})
+		} else {
+			owner, err := b.findUser(args[1])
+			if err != nil {
+				b.sendLookupError(message.Chat.ID, err)
+				return
+			}
+			if owner == nil || owner.Blocked() || owner.ID == user.ID {
+				b.send(tgbotapi.NewMessage(message.Chat.ID, "Новый владелец файлов не найден или не может их принять."))
+				return
+			}
+			candidates = append(candidates, candidate{owner.ID, "✅ Передать: " + displayName(owner)})
+		}
+	} else {
+		if user.ManagerID != 0 {
+			manager, err := b.DB.GetUser(user.ManagerID)
+			if err != nil {
+				log.Printf("Error getting manager: %v", err)
+			}
+			if manager != nil && !manager.Blocked() {
+				candidates = append(candidates, candidate{manager.ID, "👤 Руководителю: " + displayName(manager)})
+			}
+		}
+		if b.Config.ArchiveUserID != 0 && b.Config.ArchiveUserID != user.ID {
+			candidates = append(candidates, candidate{b.Config.ArchiveUserID, "📦 В архив"})
+		}
+		if len(candidates) == 0 {
+			b.send(tgbotapi.NewMessage(message.Chat.ID, "У пользователя нет руководителя, и архивный владелец не задан. Укажите, кому передать файлы: /offboard @username @руководитель"))
+			return
+		}
+	}
+
+	stats, err := b.DB.GetUserFileStats(user.ID)
+	if err != nil {
+		log.Printf("Error getting file stats: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении файлов пользователя."))
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, c := range candidates {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(c.label, fmt.Sprintf("%s%d_%d", callbackConfirmOffboard, user.ID, c.id)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", callbackCancelOffboard),
+	))
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf(
+		"Оформить увольнение %s?\n\nУчетная запись будет отключена, файлы (%d, %s) перейдут новому владельцу, а архив с ними придет в этот чат.\nВыберите, кому передать файлы:",
+		displayName(user), stats.Count, humanSize(stats.Size)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.send(msg)
+}
+
+// checkOffboard returns why the actor cannot offboard the user, or "" if they can
+func (b *Bot) checkOffboard(actorID int64, user *models.User) string {
+	switch {
+	case user.ID == actorID:
+		return "Нельзя оформить увольнение самого себя."
+	case user.Offboarded:
+		return fmt.Sprintf("%s уже уволен.", displayName(user))
+	case user.IsAdmin && !b.isAdminUser(actorID):
+		return "Увольнение администратора доступно только администраторам."
+	}
+	return b.checkOutranks(actorID, user)
+}
+
+// handleOffboardCallback carries out a confirmed offboarding
+func (b *Bot) handleOffboardCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+
+	var userID, ownerID int64
+	ids := strings.Split(strings.TrimPrefix(callback.Data, callbackConfirmOffboard), "_")
+	if len(ids) == 2 {
+		userID, _ = strconv.ParseInt(ids[0], 10, 64)
+		ownerID, _ = strconv.ParseInt(ids[1], 10, 64)
+	}
+	if userID == 0 || ownerID == 0 {
+		return
+	}
+
+	// Callback data comes from the client, so the rights are checked again
+	a, err := b.accessFor(callback.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+	}
+	if a == nil || !a.can(models.PermissionManageUsers) {
+		b.send(tgbotapi.NewMessage(chatID, "Эта команда доступна только пользователям с правом управления пользователями."))
+		return
+	}
+
+	user, err := b.DB.GetUser(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+	}
+	if user == nil {
+		b.send(tgbotapi.NewMessage(chatID, "Пользователь не найден."))
+		return
+	}
+	if text := b.checkOffboard(callback.From.ID, user); text != "" {
+		b.send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	// The archive owner does not have to be registered; anyone else must be able to use the files
+	if ownerID != b.Config.ArchiveUserID {
+		owner, err := b.DB.GetUser(ownerID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+		}
+		if owner == nil || owner.Blocked() || owner.ID == user.ID {
+			b.send(tgbotapi.NewMessage(chatID, "Новый владелец файлов не найден или не может их принять."))
+			return
+		}
+	}
+
+	b.offboard(callback.From.ID, chatID, user, ownerID)
+}
+
+// offboard deactivates the account of a user who left, hands their files over
+// to a new owner and sends an archive of the files to chatID
+func (b *Bot) offboard(actorID, chatID int64, user *models.User, ownerID int64) {
+	// Only the first of several confirmations goes through
+	done, err := b.DB.OffboardUser(user.ID)
+	if err != nil {
+		log.Printf("Error offboarding user: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при отключении учетной записи."))
+		return
+	}
+	if !done {
+		b.send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%s уже уволен.", displayName(user))))
+		return
+	}
+	b.endDialog(user.ID)
+
+	// Admin rights from the config would come back on the next status update
+	if b.Config.IsAdmin(user.ID) {
+		b.Config.SetAdmin(user.ID, false)
+		if b.Config.Path != "" {
+			if err := config.SaveConfig(b.Config, b.Config.Path); err != nil {
+				log.Printf("Error saving config: %v", err)
+			}
+		}
+		if err := b.verifyAdmins(); err != nil {
+			log.Printf("Error updating admin statuses: %v", err)
+		}
+	}
+
+	report := []string{fmt.Sprintf("🗂 %s уволен, учетная запись отключена.", displayName(user))}
+
+	// The archive is built before the handover, while the files still belong to the user
+	var archivePath string
+	files, err := b.DB.GetUserFiles(user.ID)
+	if err == nil {
+		name := fmt.Sprintf("offboarding_%d_%s.zip", user.ID, time.Now().Format("20060102-150405"))
+		archivePath, err = b.saveFilesZip(name, files, nil)
+	}
+	if err != nil {
+		log.Printf("Error building offboarding archive: %v", err)
+		report = append(report, "Ошибка при создании архива файлов.")
+	}
+
+	moved, err := b.handoverFiles(actorID, user, ownerID)
+	if err != nil {
+		log.Printf("Error handing over files: %v", err)
+		report = append(report, "Ошибка при передаче файлов.")
+	} else {
+		owner := fmt.Sprint(ownerID)
+		if u, err := b.DB.GetUser(ownerID); err == nil && u != nil {
+			owner = displayName(u)
+		}
+		report = append(report, fmt.Sprintf("Файлов передано: %d, новый владелец: %s.", moved, owner))
+	}
+
+	// Rows of files that stayed with the user, such as deleted ones, are marked in the reports
+	b.report(&ReportEvent{Type: EventOffboard, Time: time.Now(), UserID: user.ID, Username: user.Username,
+		FirstName: user.FirstName, LastName: user.LastName, Offboarded: true})
+	b.audit(actorID, models.AuditOffboard, user.ID, displayName(user))
+
+	b.send(tgbotapi.NewMessage(chatID, strings.Join(report, "\n")))
+	if archivePath != "" {
+		b.sendArchive(chatID, archivePath, fmt.Sprintf("Файлы %s: %d", displayName(user), len(files)))
+	}
+}
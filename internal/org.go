@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"telegram-bot/db"
+)
+
+// OrgImportReport summarizes an import of the org structure
+type OrgImportReport struct {
+	Updated int
+	Skipped []string
+}
+
+func (r *OrgImportReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Обновлено пользователей: %d", r.Updated)
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&b, "\nПропущено строк: %d", len(r.Skipped))
+		for _, reason := range r.Skipped {
+			b.WriteString("\n  " + reason)
+		}
+	}
+	return b.String()
+}
+
+// ImportOrgCSV reads the org structure from a CSV file with the columns
+// user, department and manager, separated by commas or semicolons. Users and
+// managers are given as numeric IDs or @usernames and must have written to the
+// bot before. An empty department or manager clears it; missing departments are created.
+func ImportOrgCSV(database *db.DB, path string) (*OrgImportReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Excel saves UTF-8 CSV with a byte order mark, which would stick to the first header
+	in := bufio.NewReader(f)
+	if bom, _ := in.Peek(3); string(bom) == "\ufeff" {
+		in.Discard(3)
+	}
+
+	// Spreadsheet programs with a Russian locale export CSV with semicolons
+	firstLine, _ := in.Peek(4096)
+	if i := strings.IndexByte(string(firstLine), '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		r.Comma = ';'
+	}
+
+	report := &OrgImportReport{}
+	// An ambiguous username skips the row: the file should name such users by ID
+	var ambiguous *ambiguousUserError
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		for len(record) < 3 {
+			record = append(record, "")
+		}
+		userArg := strings.TrimSpace(record[0])
+		departmentName := strings.TrimSpace(record[1])
+		managerArg := strings.TrimSpace(record[2])
+
+		if userArg == "" || (line == 1 && strings.EqualFold(userArg, "user")) {
+			continue
+		}
+
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("строка %d: %s", line, reason))
+		}
+
+		user, err := lookupUser(database, userArg)
+		if errors.As(err, &ambiguous) {
+			skip(ambiguous.text())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			skip(fmt.Sprintf("пользователь %s не найден", userArg))
+			continue
+		}
+
+		var managerID int64
+		if managerArg != "" {
+			manager, err := lookupUser(database, managerArg)
+			if errors.As(err, &ambiguous) {
+				skip(ambiguous.text())
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if manager == nil {
+				skip(fmt.Sprintf("руководитель %s не найден", managerArg))
+				continue
+			}
+			if manager.ID == user.ID {
+				skip(fmt.Sprintf("пользователь %s указан своим руководителем", userArg))
+				continue
+			}
+			managerID = manager.ID
+		}
+
+		var departmentID int64
+		if departmentName != "" {
+			department, err := database.GetOrCreateDepartment(departmentName)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create department %s: %w", departmentName, err)
+			}
+			departmentID = department.ID
+		}
+
+		if err := database.SetUserOrg(user.ID, departmentID, managerID); err != nil {
+			return nil, fmt.Errorf("unable to update user %d: %w", user.ID, err)
+		}
+		report.Updated++
+	}
+	return report, nil
+}
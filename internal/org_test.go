@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"telegram-bot/models"
+	"testing"
+	"time"
+)
+
+func TestImportOrgCSV(t *testing.T) {
+	type org struct {
+		department string
+		managerID  int64
+	}
+	tests := []struct {
+		name        string
+		csv         string
+		want        map[int64]org
+		wantUpdated int
+		wantSkipped int
+	}{
+		{
+			name:        "commas",
+			csv:         "user,department,manager\n1,Sales,2\n@boss,Sales,\n",
+			want:        map[int64]org{1: {"Sales", 2}, 2: {"Sales", 0}},
+			wantUpdated: 2,
+		},
+		{
+			name:        "semicolons",
+			csv:         "user;department;manager\n1;Продажи;@boss\n",
+			want:        map[int64]org{1: {"Продажи", 2}},
+			wantUpdated: 1,
+		},
+		{
+			name:        "semicolons with a comma in a department",
+			csv:         "user;department;manager\n1;\"Sales, East\";2\n",
+			want:        map[int64]org{1: {"Sales, East", 2}},
+			wantUpdated: 1,
+		},
+		{
+			name:        "commas with a semicolon in a department",
+			csv:         "user,department,manager\n1,\"R&D; Lab\",2\n",
+			want:        map[int64]org{1: {"R&D; Lab", 2}},
+			wantUpdated: 1,
+		},
+		{
+			name:        "byte order mark before the header",
+			csv:         "\ufeffuser;department;manager\n1;Sales;2\n",
+			want:        map[int64]org{1: {"Sales", 2}},
+			wantUpdated: 1,
+		},
+		{
+			name:        "no header and missing columns",
+			csv:         "1,Sales\n",
+			want:        map[int64]org{1: {"Sales", 0}},
+			wantUpdated: 1,
+		},
+		{
+			name:        "unknown users and self-managers are skipped",
+			csv:         "user,department,manager\n@nobody,Sales,\n1,Sales,@nobody\n1,Sales,1\n3,,2\n",
+			want:        map[int64]org{1: {"", 0}, 3: {"", 2}},
+			wantUpdated: 1,
+			wantSkipped: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDB(t)
+			now := time.Now()
+			for _, user := range []*models.User{{ID: 1, Username: "ivanov"}, {ID: 2, Username: "boss"}, {ID: 3}} {
+				user.CreatedAt, user.LastSeen = now, now
+				if err := database.SaveUser(user); err != nil {
+					t.Fatalf("SaveUser: %v", err)
+				}
+			}
+
+			path := filepath.Join(t.TempDir(), "org.csv")
+			if err := os.WriteFile(path, []byte(tt.csv), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			report, err := ImportOrgCSV(database, path)
+			if err != nil {
+				t.Fatalf("ImportOrgCSV: %v", err)
+			}
+			if report.Updated != tt.wantUpdated || len(report.Skipped) != tt.wantSkipped {
+				t.Errorf("report = %+v, want %d updated and %d skipped", report, tt.wantUpdated, tt.wantSkipped)
+			}
+
+			for id, want := range tt.want {
+				user, err := database.GetUser(id)
+				if err != nil || user == nil {
+					t.Fatalf("GetUser(%d) = %v, %v", id, user, err)
+				}
+				if got := (org{user.Department, user.ManagerID}); got != want {
+					t.Errorf("user %d: %+v, want %+v", id, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// How often the worker looks for due entries
+	outboxPollInterval = 5 * time.Second
+
+	// Maximum number of entries processed in one pass
+	outboxBatchSize = 50
+
+	// How long the worker waits after a new event so that a burst is delivered in one batch
+	outboxBatchWindow = 2 * time.Second
+
+	// Retry delays for failed entries
+	outboxInitialRetryDelay = 10 * time.Second
+	outboxMaxRetryDelay     = time.Hour
+
+	// Failed attempts after which an entry is no longer retried, about a day of retries
+	outboxMaxAttempts = 30
+
+	// Number of failed entries listed by /outbox
+	outboxListLimit = 20
+
+	// Pause of a sink that reported a rate limit, doubled while the limit persists
+	outboxInitialRateLimitDelay = 15 * time.Second
+	outboxMaxRateLimitDelay     = 10 * time.Minute
+)
+
+// report stores the event in the outbox once for every sink; the background worker delivers it
+func (b *Bot) report(event *ReportEvent) {
+	if len(b.sinks) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding outbox payload: %v", err)
+		return
+	}
+
+	for _, sink := range b.sinks {
+		if err := b.DB.EnqueueOutbox(sink.Name(), event.Type, event.FileID, event.UserID, string(data)); err != nil {
+			log.Printf("Error adding %s event to outbox of %s: %v", event.Type, sink.Name(), err)
+		}
+	}
+
+	b.wakeOutbox()
+}
+
+// wakeOutbox makes the worker deliver the outbox without waiting for the next poll
+func (b *Bot) wakeOutbox() {
+	select {
+	case b.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// runOutboxWorker delivers outbox entries until the bot stops
+func (b *Bot) runOutboxWorker() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		b.processOutbox()
+
+		select {
+		case <-ticker.C:
+		case <-b.outboxWake:
+			// Let a burst of events accumulate so they are written together
+			time.Sleep(outboxBatchWindow)
+		}
+	}
+}
+
+// processOutbox attempts all due entries, grouped by sink. Failed entries are retried
+// with exponential backoff; a rate limited sink is paused as a whole.
+func (b *Bot) processOutbox() {
+	if len(b.sinks) == 0 {
+		return
+	}
+
+	entries, err := b.DB.GetDueOutbox(outboxBatchSize)
+	if err != nil {
+		log.Printf("Error reading outbox: %v", err)
+		return
+	}
+
+	var names []string
+	groups := make(map[string][]*models.OutboxEntry)
+	for _, entry := range entries {
+		if groups[entry.Sink] == nil {
+			names = append(names, entry.Sink)
+		}
+		groups[entry.Sink] = append(groups[entry.Sink], entry)
+	}
+	for _, name := range names {
+		b.deliverOutbox(name, groups[name])
+	}
+
+	if pending, failed, err := b.DB.CountOutbox(); err == nil {
+		metricOutboxPending.Set(pending)
+		metricOutboxDead.Set(failed)
+	}
+}
+
+// deliverOutbox passes the events of outbox entries to their sink, in one batch if the sink supports it
+func (b *Bot) deliverOutbox(name string, entries []*models.OutboxEntry) {
+	sink := b.sink(name)
+	if sink == nil {
+		// The sink was removed from the configuration; the entries can never be delivered
+		for _, entry := range entries {
+			log.Printf("Outbox entry %d dropped: sink %q is not configured", entry.ID, entry.Sink)
+			b.deleteOutbox(entry)
+		}
+		return
+	}
+
+	// Entries of a paused sink wait until the pause is over
+	if until, ok := b.sinkPausedUntil[name]; ok && time.Now().Before(until) {
+		for _, entry := range entries {
+			if err := b.DB.RescheduleOutbox(entry.ID, entry.Attempts, until, entry.LastError); err != nil {
+				log.Printf("Error rescheduling outbox entry %d: %v", entry.ID, err)
+			}
+		}
+		return
+	}
+
+	// Entries about a user or file whose earlier entry failed are left for the next
+	// pass, when GetDueOutbox holds them back until the failed one is delivered
+	held := newOutboxHold()
+
+	var ready []*models.OutboxEntry
+	var events []*ReportEvent
+	for _, entry := range entries {
+		if held.holds(entry) {
+			continue
+		}
+		event, err := b.outboxEvent(entry)
+		if err != nil {
+			b.retryOutbox(entry, err)
+			held.add(entry)
+			continue
+		}
+		ready = append(ready, entry)
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	if batch, ok := sink.(BatchSink); ok && len(events) > 1 {
+		metricOutboxBatches.Add(name, 1)
+		b.finishOutbox(name, ready, batch.ReportBatch(events))
+		return
+	}
+
+	for i, event := range events {
+		if held.holds(ready[i]) {
+			continue
+		}
+		err := sink.Report(event)
+		b.finishOutbox(name, ready[i:i+1], err)
+		if isRateLimited(err) {
+			// The rest waits for the end of the pause
+			b.deliverOutbox(name, ready[i+1:])
+			return
+		}
+		if err != nil {
+			held.add(ready[i])
+		}
+	}
+}
+
+// outboxHold tracks the users and files whose entries failed during one delivery pass
+type outboxHold struct {
+	users map[int64]bool
+	files map[int64]bool
+}
+
+func newOutboxHold() *outboxHold {
+	return &outboxHold{users: make(map[int64]bool), files: make(map[int64]bool)}
+}
+
+// add holds back the later entries about the user and file of a failed entry
+func (h *outboxHold) add(entry *models.OutboxEntry) {
+	h.users[entry.UserID] = true
+	if entry.FileID != 0 {
+		h.files[entry.FileID] = true
+	}
+}
+
+// holds reports whether the entry must wait for an earlier failed one
+func (h *outboxHold) holds(entry *models.OutboxEntry) bool {
+	return h.users[entry.UserID] || (entry.FileID != 0 && h.files[entry.FileID])
+}
+
+// finishOutbox removes delivered entries or schedules them for another attempt
+func (b *Bot) finishOutbox(name string, entries []*models.OutboxEntry, err error) {
+	if err == nil {
+		delete(b.sinkBackoff, name)
+		delete(b.sinkPausedUntil, name)
+		for _, entry := range entries {
+			b.deleteOutbox(entry)
+		}
+		metricOutboxDelivered.Add(name, int64(len(entries)))
+		log.Printf("%d outbox event(s) delivered to %s", len(entries), name)
+		return
+	}
+
+	metricOutboxFailed.Add(name, int64(len(entries)))
+
+	if !isRateLimited(err) {
+		for _, entry := range entries {
+			b.retryOutbox(entry, err)
+		}
+		return
+	}
+
+	// Quota exceeded: pause the whole sink, doubling the pause while the limit persists
+	delay := b.sinkBackoff[name] * 2
+	if delay < outboxInitialRateLimitDelay {
+		delay = outboxInitialRateLimitDelay
+	}
+	if delay > outboxMaxRateLimitDelay {
+		delay = outboxMaxRateLimitDelay
+	}
+	until := time.Now().Add(delay)
+	b.sinkBackoff[name] = delay
+	b.sinkPausedUntil[name] = until
+	log.Printf("Sink %s is rate limited, pausing for %s: %v", name, delay, err)
+
+	for _, entry := range entries {
+		if err := b.DB.RescheduleOutbox(entry.ID, entry.Attempts+1, until, err.Error()); err != nil {
+			log.Printf("Error rescheduling outbox entry %d: %v", entry.ID, err)
+		}
+	}
+}
+
+// retryOutbox schedules a failed entry for another attempt. After outboxMaxAttempts
+// the entry is kept as failed until an admin retries or drops it with /outbox.
+func (b *Bot) retryOutbox(entry *models.OutboxEntry, err error) {
+	attempts := entry.Attempts + 1
+	if attempts >= outboxMaxAttempts {
+		log.Printf("Outbox entry %d (%s to %s) failed %d times and will not be retried: %v", entry.ID, entry.Kind, entry.Sink, attempts, err)
+		if err := b.DB.FailOutbox(entry.ID, attempts, err.Error()); err != nil {
+			log.Printf("Error marking outbox entry %d as failed: %v", entry.ID, err)
+			return
+		}
+		b.notifyAdmins(fmt.Sprintf("⚠️ Событие «%s» (запись %d) не удалось доставить в %s после %d попыток: %v\nСписок недоставленных событий: /outbox",
+			eventLabels[entry.Kind], entry.ID, entry.Sink, attempts, err))
+		return
+	}
+
+	delay := outboxRetryDelay(attempts)
+	log.Printf("Outbox entry %d (%s to %s) failed, attempt %d, next in %s: %v", entry.ID, entry.Kind, entry.Sink, attempts, delay, err)
+
+	if err := b.DB.RescheduleOutbox(entry.ID, attempts, time.Now().Add(delay), err.Error()); err != nil {
+		log.Printf("Error rescheduling outbox entry %d: %v", entry.ID, err)
+	}
+}
+
+// deleteOutbox removes an entry from the outbox
+func (b *Bot) deleteOutbox(entry *models.OutboxEntry) {
+	if err := b.DB.DeleteOutbox(entry.ID); err != nil {
+		log.Printf("Error deleting outbox entry %d: %v", entry.ID, err)
+	}
+}
+
+// handleOutboxCommand shows the outbox entries that ran out of attempts: /outbox.
+// "/outbox retry" queues them again, "/outbox drop" deletes them.
+func (b *Bot) handleOutboxCommand(message *tgbotapi.Message) {
+	if !b.isAdminUser(message.From.ID) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только администраторам."))
+		return
+	}
+
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "retry":
+		n, err := b.DB.RetryFailedOutbox()
+		if err != nil {
+			log.Printf("Error retrying outbox entries: %v", err)
+			b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при возврате событий в очередь."))
+			return
+		}
+		b.wakeOutbox()
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Событий возвращено в очередь: %d.", n)))
+
+	case "drop":
+		n, err := b.DB.DeleteFailedOutbox()
+		if err != nil {
+			log.Printf("Error deleting outbox entries: %v", err)
+			b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при удалении событий."))
+			return
+		}
+		log.Printf("User %d dropped %d failed outbox entries", message.From.ID, n)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Недоставленных событий удалено: %d. Недостающие строки таблицы можно восстановить сверкой: /reconcile", n)))
+
+	case "":
+		b.sendFailedOutbox(message.Chat.ID)
+
+	default:
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Используйте /outbox, /outbox retry или /outbox drop."))
+	}
+}
+
+// sendFailedOutbox lists the entries that ran out of attempts
+func (b *Bot) sendFailedOutbox(chatID int64) {
+	pending, failed, err := b.DB.CountOutbox()
+	var entries []*models.OutboxEntry
+	if err == nil && failed > 0 {
+		entries, err = b.DB.GetFailedOutbox(outboxListLimit)
+	}
+	if err != nil {
+		log.Printf("Error reading outbox: %v", err)
+		b.send(tgbotapi.NewMessage(chatID, "Ошибка при чтении очереди."))
+		return
+	}
+	if failed == 0 {
+		b.send(tgbotapi.NewMessage(chatID, fmt.Sprintf("В очереди: %d. Недоставленных событий нет.", pending)))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("В очереди: %d. Не доставлено: %d.\n\n", pending, failed))
+	for _, entry := range entries {
+		response.WriteString(fmt.Sprintf("%d. %s → %s, пользователь %d", entry.ID, eventLabels[entry.Kind], entry.Sink, entry.UserID))
+		if entry.FileID != 0 {
+			response.WriteString(fmt.Sprintf(", файл %d", entry.FileID))
+		}
+		response.WriteString(fmt.Sprintf(", %s, попыток: %d\n%s\n", entry.FailedAt.Format("2006-01-02 15:04"), entry.Attempts, entry.LastError))
+	}
+	if failed > int64(len(entries)) {
+		response.WriteString(fmt.Sprintf("…и еще %d\n", failed-int64(len(entries))))
+	}
+	response.WriteString("\n/outbox retry — повторить доставку, /outbox drop — удалить недоставленные события")
+	b.sendText(chatID, response.String())
+}
+
+// outboxEvent decodes the event of an outbox entry
+func (b *Bot) outboxEvent(entry *models.OutboxEntry) (*ReportEvent, error) {
+	var event ReportEvent
+	if err := json.Unmarshal([]byte(entry.Payload), &event); err != nil {
+		return nil, err
+	}
+	event.Type = entry.Kind
+	if event.Time.IsZero() {
+		event.Time = entry.CreatedAt
+	}
+
+	// Uploads carry the current user profile; the name from the upload is used if the user is gone
+	if event.Type == EventUpload || event.Type == EventReassign || event.Type == EventOffboard {
+		user, err := b.DB.GetUser(event.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			if user.Username != "" {
+				event.Username = user.Username
+			}
+			event.FirstName = user.FirstName
+			event.LastName = user.LastName
+			event.Phone = user.Phone
+			event.Position = user.Position
+			event.EmployeeID = user.EmployeeID
+			event.Email = user.Email
+			event.Department = user.Department
+			event.HireDate = user.HireDate
+			event.Offboarded = user.Offboarded
+		}
+	}
+
+	return &event, nil
+}
+
+// sink returns the configured sink with the given name
+func (b *Bot) sink(name string) ReportSink {
+	for _, sink := range b.sinks {
+		if sink.Name() == name {
+			return sink
+		}
+	}
+	return nil
+}
+
+// outboxRetryDelay returns the delay before the given attempt, doubling up to a limit
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxInitialRetryDelay
+	for i := 1; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxRetryDelay {
+		delay = outboxMaxRetryDelay
+	}
+	return delay
+}
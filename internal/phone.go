@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"telegram-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// normalizePhone converts a phone number typed by hand or listed in the whitelist
+// to E.164 (+79001234567). Numbers in the Russian national format (8 900 ...)
+// get the country code 7. It returns an empty string if the number cannot be
+// a valid phone number.
+func normalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	// 00 is the international call prefix, as + is
+	if !international && strings.HasPrefix(digits, "00") {
+		digits = digits[2:]
+		international = true
+	}
+	if !international && len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+	}
+	// E.164 numbers have at most 15 digits and never start with 0
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return ""
+	}
+	return "+" + digits
+}
+
+// internationalPhone converts a number that always carries the country code to E.164.
+// Telegram sends contact numbers in this form but often without the leading "+",
+// so 84912345678 is a Vietnamese number, not a Russian one in the national format.
+func internationalPhone(phone string) string {
+	return normalizePhone("+" + strings.TrimPrefix(strings.TrimSpace(phone), "+"))
+}
+
+// contactPhone returns the number of a shared contact in E.164, or as sent if it cannot be normalized
+func contactPhone(contact *tgbotapi.Contact) string {
+	if phone := internationalPhone(contact.PhoneNumber); phone != "" {
+		return phone
+	}
+	return contact.PhoneNumber
+}
+
+// ownContact reports whether the shared contact is the sender's own number.
+// The contact button sends the account's number; a contact forwarded from
+// the address book belongs to someone else or has no user ID.
+func ownContact(message *tgbotapi.Message) bool {
+	return message.Contact != nil && message.Contact.UserID == message.From.ID
+}
+
+// sendForeignContact asks the user to share their own number with the button
+func (b *Bot) sendForeignContact(chatID int64) {
+	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButtonContact("Поделиться номером телефона"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, "Это чужой контакт. Пожалуйста, поделитесь своим номером с помощью кнопки ниже.")
+	msg.ReplyMarkup = keyboard
+	b.send(msg)
+}
+
+// handlePhoneCommand starts a phone number change. The new number is taken
+// only from the contact button, so it is verified by Telegram.
+func (b *Bot) handlePhoneCommand(message *tgbotapi.Message, user *models.User) {
+	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButtonContact("Поделиться номером телефона"),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(cancelButton),
+		),
+	)
+
+	text := fmt.Sprintf("Ваш номер: %s.\n\nЧтобы изменить его, поделитесь номером кнопкой ниже. "+
+		"Бот принимает только номер, привязанный к вашему аккаунту Telegram: если номер изменился, "+
+		"сначала смените его в настройках Telegram.", user.Phone)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	b.send(msg)
+
+	b.setDialog(message.From.ID, dialogPhone)
+}
+
+// handlePhoneDialog handles the reply to /phone
+func (b *Bot) handlePhoneDialog(message *tgbotapi.Message) {
+	if message.Contact == nil {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Поделитесь номером кнопкой ниже или нажмите «Отмена»."))
+		return
+	}
+	if !ownContact(message) {
+		b.sendForeignContact(message.Chat.ID)
+		return
+	}
+
+	b.endDialog(message.From.ID)
+	phone := contactPhone(message.Contact)
+
+	user, err := b.DB.GetUser(message.From.ID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+	}
+	if user != nil && user.Phone == phone {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Номер не изменился.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		b.send(msg)
+		return
+	}
+
+	if err := b.DB.UpdateUserPhone(message.From.ID, phone); err != nil {
+		log.Printf("Error updating phone: %v", err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка при сохранении номера.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		b.send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ Номер телефона изменен на %s.", phone))
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	b.send(msg)
+}
+
+// normalizeStoredPhones converts phone numbers saved before normalization to E.164.
+// Stored numbers come from shared contacts, so they already carry the country code.
+func (b *Bot) normalizeStoredPhones() error {
+	n, err := b.DB.NormalizePhones(internationalPhone)
+	if n > 0 {
+		log.Printf("Normalized %d stored phone numbers", n)
+	}
+	return err
+}
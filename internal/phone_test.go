@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+7 900 123-45-67", "+79001234567"},
+		{"89001234567", "+79001234567"},
+		{"8 (900) 123-45-67", "+79001234567"},
+		{"79001234567", "+79001234567"},
+		{"  +79001234567  ", "+79001234567"},
+		{"0079001234567", "+79001234567"},
+		{"+84912345678", "+84912345678"},
+		{"+8 900 123 45 67", "+89001234567"},
+		{"+44 20 7946 0958", "+442079460958"},
+		{"8900123456", "+8900123456"},
+		{"", ""},
+		{"не номер", ""},
+		{"1234567", ""},
+		{"+1234567890123456", ""},
+		{"+0123456789", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizePhone(tt.phone); got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestInternationalPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"79001234567", "+79001234567"},
+		{"+79001234567", "+79001234567"},
+		{"84912345678", "+84912345678"},
+		{"  447946095812 ", "+447946095812"},
+		{"", ""},
+		{"0123456789", ""},
+	}
+
+	for _, tt := range tests {
+		if got := internationalPhone(tt.phone); got != tt.want {
+			t.Errorf("internationalPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestContactPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"84912345678", "+84912345678"},
+		{"123", "123"},
+	}
+
+	for _, tt := range tests {
+		if got := contactPhone(&tgbotapi.Contact{PhoneNumber: tt.phone}); got != tt.want {
+			t.Errorf("contactPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"telegram-bot/models"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Layout of dates typed by users and shown in the profile
+const profileDateLayout = "02.01.2006"
+
+// Reply keyboard button that closes the profile
+const doneButton = "Готово"
+
+// A value that clears a profile field
+const clearValue = "-"
+
+// profileField is a field the user can edit with /profile
+type profileField struct {
+	key    string
+	button string
+	prompt string
+}
+
+var profileFields = []profileField{
+	{"position", "Должность", "Введите вашу должность."},
+	{"employee_id", "Табельный номер", "Введите ваш табельный номер."},
+	{"email", "Email", "Введите рабочий адрес электронной почты."},
+	{"department", "Отдел", "Введите название вашего отдела."},
+	{"hire_date", "Дата приема", "Введите дату приема на работу в формате ДД.ММ.ГГГГ, например 01.09.2025."},
+}
+
+// handleProfileCommand shows the user's profile and lets them pick a field to edit
+func (b *Bot) handleProfileCommand(message *tgbotapi.Message, user *models.User) {
+	b.setDialog(user.ID, dialogProfile)
+	b.sendProfileMenu(message.Chat.ID, user, "")
+}
+
+// sendProfileMenu sends the profile with the field buttons, after an optional note
+func (b *Bot) sendProfileMenu(chatID int64, user *models.User, note string) {
+	var rows [][]tgbotapi.KeyboardButton
+	for i := 0; i < len(profileFields); i += 2 {
+		row := tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(profileFields[i].button))
+		if i+1 < len(profileFields) {
+			row = append(row, tgbotapi.NewKeyboardButton(profileFields[i+1].button))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(doneButton)))
+
+	text := profileText(user) + "\nВыберите поле, которое хотите изменить, или нажмите «Готово»."
+	if note != "" {
+		text = note + "\n\n" + text
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(rows...)
+	b.send(msg)
+}
+
+// profileText describes the profile fields of a user
+func profileText(user *models.User) string {
+	value := func(s string) string {
+		if s == "" {
+			return "не указано"
+		}
+		return s
+	}
+	hireDate := ""
+	if !user.HireDate.IsZero() {
+		hireDate = user.HireDate.Format(profileDateLayout)
+	}
+
+	var text strings.Builder
+	text.WriteString("👤 Ваш профиль\n")
+	text.WriteString(fmt.Sprintf("Должность: %s\n", value(user.Position)))
+	text.WriteString(fmt.Sprintf("Табельный номер: %s\n", value(user.EmployeeID)))
+	text.WriteString(fmt.Sprintf("Email: %s\n", value(user.Email)))
+	text.WriteString(fmt.Sprintf("Отдел: %s\n", value(user.Department)))
+	text.WriteString(fmt.Sprintf("Дата приема: %s\n", value(hireDate)))
+	return text.String()
+}
+
+// handleProfileMenu handles the choice of a profile field
+func (b *Bot) handleProfileMenu(message *tgbotapi.Message) {
+	choice := strings.TrimSpace(message.Text)
+	if choice == doneButton {
+		b.endDialog(message.From.ID)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Профиль сохранен.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		b.send(msg)
+		return
+	}
+
+	for _, field := range profileFields {
+		if field.button != choice {
+			continue
+		}
+		if text := b.readOnlyField(message.From.ID, field.key); text != "" {
+			b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+			return
+		}
+
+		b.setDialog(message.From.ID, dialogProfileField+field.key)
+		msg := tgbotapi.NewMessage(message.Chat.ID, field.prompt+fmt.Sprintf(" Чтобы очистить поле, отправьте «%s».", clearValue))
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+			tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(cancelButton)),
+		)
+		b.send(msg)
+		return
+	}
+
+	b.send(tgbotapi.NewMessage(message.Chat.ID, "Выберите поле кнопкой ниже или нажмите «Готово»."))
+}
+
+// readOnlyField returns why the user cannot edit the profile field, or "" if they can
+func (b *Bot) readOnlyField(userID int64, key string) string {
+	if key != "employee_id" && key != "department" {
+		return ""
+	}
+	user, err := b.DB.GetUser(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+	}
+	if user == nil {
+		return ""
+	}
+
+	switch {
+	// The employee ID checked at registration is changed only by admins
+	case key == "employee_id" && b.Config.Registration.Restricted && user.EmployeeID != "":
+		return "Табельный номер подтвержден при регистрации. Чтобы изменить его, обратитесь к администратору."
+	// The org structure imported by admins takes precedence over the profile
+	case key == "department" && user.OrgImported:
+		return "Отдел задан администратором при импорте оргструктуры. Чтобы изменить его, обратитесь к администратору."
+	}
+	return ""
+}
+
+// handleProfileValue validates and saves a new value of a profile field
+func (b *Bot) handleProfileValue(message *tgbotapi.Message, key string) {
+	user, err := b.DB.GetUser(message.From.ID)
+	if err != nil || user == nil {
+		log.Printf("Error getting user: %v", err)
+		b.endDialog(message.From.ID)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении профиля."))
+		return
+	}
+
+	// The field may have become read-only while the user was typing
+	if text := b.readOnlyField(user.ID, key); text != "" {
+		b.setDialog(user.ID, dialogProfile)
+		b.sendProfileMenu(message.Chat.ID, user, text)
+		return
+	}
+
+	value := strings.TrimSpace(message.Text)
+	if value == "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Отправьте значение текстом."))
+		return
+	}
+	if value == clearValue {
+		value = ""
+	}
+
+	// A rejected value keeps the dialog waiting for another try
+	if problem := b.setProfileField(user, key, value); problem != "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, problem))
+		return
+	}
+
+	if err := b.DB.UpdateUserProfile(user); err != nil {
+		log.Printf("Error saving profile: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при сохранении профиля."))
+		return
+	}
+
+	// The department name is read back together with the user
+	if updated, err := b.DB.GetUser(user.ID); err == nil && updated != nil {
+		user = updated
+	}
+	b.setDialog(user.ID, dialogProfile)
+	b.sendProfileMenu(message.Chat.ID, user, "✅ Сохранено.")
+}
+
+// setProfileField sets a field of the profile. It returns why the value is
+// rejected, or "" if it was set.
+func (b *Bot) setProfileField(user *models.User, key, value string) string {
+	switch key {
+	case "position":
+		if utf8.RuneCountInString(value) > 100 {
+			return "Слишком длинное название должности."
+		}
+		user.Position = value
+
+	case "employee_id":
+		if utf8.RuneCountInString(value) > 50 {
+			return "Слишком длинный табельный номер."
+		}
+		if value != "" && b.Config.Registration.Restricted {
+			// A whitelisted ID is confirmed at registration, or another user
+			// could claim it and lock the real employee out
+			list, err := b.loadWhitelist()
+			if err != nil {
+				log.Printf("Error loading whitelist: %v", err)
+				return "Ошибка при проверке табельного номера."
+			}
+			if list.employeeIDs[strings.ToUpper(value)] {
+				return "Этот табельный номер есть в списке сотрудников и подтверждается только при регистрации. Обратитесь к администратору."
+			}
+		}
+		if value != "" {
+			owner, err := b.DB.GetUserByEmployeeID(value)
+			if err != nil {
+				log.Printf("Error checking employee ID: %v", err)
+				return "Ошибка при проверке табельного номера."
+			}
+			if owner != nil && owner.ID != user.ID {
+				return "Этот табельный номер уже указан другим пользователем."
+			}
+		}
+		user.EmployeeID = value
+
+	case "email":
+		if value != "" {
+			address, err := mail.ParseAddress(value)
+			if err != nil || address.Address != value {
+				return "Это не похоже на адрес электронной почты. Например: ivanov@example.com"
+			}
+		}
+		user.Email = value
+
+	case "department":
+		user.DepartmentID = 0
+		if value != "" {
+			department, err := b.DB.GetDepartmentByName(value)
+			if err != nil {
+				log.Printf("Error getting department: %v", err)
+				return "Ошибка при поиске отдела."
+			}
+			if department == nil {
+				return fmt.Sprintf("Отдел «%s» не найден. Проверьте название или обратитесь к администратору.", value)
+			}
+			user.DepartmentID = department.ID
+		}
+
+	case "hire_date":
+		user.HireDate = time.Time{}
+		if value != "" {
+			date, err := time.Parse(profileDateLayout, value)
+			if err != nil {
+				return "Не удалось разобрать дату. Введите ее в формате ДД.ММ.ГГГГ, например 01.09.2025."
+			}
+			if date.After(time.Now()) {
+				return "Дата приема не может быть в будущем."
+			}
+			user.HireDate = date
+		}
+	}
+	return ""
+}
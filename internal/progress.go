@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Minimum interval between edits of a status message
+	statusEditInterval = 2 * time.Second
+
+	// Chat actions expire after 5 seconds, so they are repeated a bit sooner
+	chatActionInterval = 4 * time.Second
+)
+
+// uploadStatus is a single status message that is edited as an upload goes through its stages.
+// While the upload runs, the chat shows the "sending file" action.
+type uploadStatus struct {
+	bot    *Bot
+	chatID int64
+
+	mu        sync.Mutex
+	messageID int
+	lastText  string
+	lastEdit  time.Time
+
+	stopAction chan struct{}
+	stopOnce   sync.Once
+}
+
+// startUploadStatus sends the initial status message and starts the chat action indicator
+func (b *Bot) startUploadStatus(chatID int64) *uploadStatus {
+	s := &uploadStatus{
+		bot:        b,
+		chatID:     chatID,
+		stopAction: make(chan struct{}),
+	}
+
+	text := "⏳ Скачивание файла..."
+	if sent, err := b.send(tgbotapi.NewMessage(chatID, text)); err == nil {
+		s.messageID = sent.MessageID
+		s.lastText = text
+		s.lastEdit = time.Now()
+	}
+
+	go s.keepChatAction()
+	return s
+}
+
+// keepChatAction shows the upload indicator until the status is finished
+func (s *uploadStatus) keepChatAction() {
+	ticker := time.NewTicker(chatActionInterval)
+	defer ticker.Stop()
+
+	for {
+		// Chat actions return true instead of a message, so they go through Request
+		s.bot.API.Request(tgbotapi.NewChatAction(s.chatID, tgbotapi.ChatUploadDocument))
+
+		select {
+		case <-s.stopAction:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update replaces the status text
+func (s *uploadStatus) update(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.edit(text)
+}
+
+// progress reports download progress. Edits are throttled to stay within Telegram limits.
+func (s *uploadStatus) progress(done, total int64) {
+	if total <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastEdit) < statusEditInterval {
+		return
+	}
+	s.edit(fmt.Sprintf("⏳ Скачивание файла: %d%%", done*100/total))
+}
+
+// finish stops the chat action and shows the final result of the upload
+func (s *uploadStatus) finish(text string) {
+	s.stopOnce.Do(func() { close(s.stopAction) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Without a status message the result is sent as a new one
+	if s.messageID == 0 {
+		s.bot.send(tgbotapi.NewMessage(s.chatID, text))
+		return
+	}
+	s.edit(text)
+}
+
+// edit changes the status message text; the caller must hold s.mu
+func (s *uploadStatus) edit(text string) {
+	if s.messageID == 0 || text == s.lastText {
+		return
+	}
+
+	s.bot.send(tgbotapi.NewEditMessageText(s.chatID, s.messageID, text))
+	s.lastText = text
+	s.lastEdit = time.Now()
+}
+
+// progressReader reports how many bytes have been read from the underlying reader
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	read       int64
+	onProgress func(done, total int64)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+	if n > 0 && p.onProgress != nil {
+		p.onProgress(p.read, p.total)
+	}
+	return n, err
+}
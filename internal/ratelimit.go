@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"telegram-bot/config"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Telegram allows about 30 messages per second across all chats
+	outgoingPerSecond = 30
+
+	// Buckets untouched for this long are dropped
+	bucketIdleTimeout = 10 * time.Minute
+)
+
+// tokenBucket is a token bucket refilled at a constant rate
+type tokenBucket struct {
+	tokens      float64
+	capacity    float64
+	rate        float64 // tokens per second
+	last        time.Time
+	warnedUntil time.Time
+}
+
+func newTokenBucket(capacity, perSecond float64, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: capacity, capacity: capacity, rate: perSecond, last: now}
+}
+
+// refill adds the tokens accumulated since the last call
+func (tb *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(tb.last).Seconds()
+	if elapsed > 0 {
+		tb.tokens += elapsed * tb.rate
+		if tb.tokens > tb.capacity {
+			tb.tokens = tb.capacity
+		}
+		tb.last = now
+	}
+}
+
+// take removes a token if one is available, otherwise returns the time until the next token
+func (tb *tokenBucket) take(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	if tb.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+type bucketKey struct {
+	userID int64
+	class  string
+}
+
+// RateLimiter keeps a token bucket per user and action class
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]config.RateLimit
+	buckets   map[bucketKey]*tokenBucket
+	lastPrune time.Time
+}
+
+// NewRateLimiter creates a rate limiter with the given limits per action class
+func NewRateLimiter(limits map[string]config.RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limits:    limits,
+		buckets:   make(map[bucketKey]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes a token from the user's bucket for the class. It returns zero if the
+// action is allowed, otherwise the time until it will be. notify is false when the
+// user has already been told to wait during the current period.
+func (l *RateLimiter) Allow(userID int64, class string) (wait time.Duration, notify bool) {
+	limit, ok := l.limits[class]
+	if !ok || limit.Burst <= 0 {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	key := bucketKey{userID: userID, class: class}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(float64(limit.Burst), limit.PerMinute/60, now)
+		l.buckets[key] = bucket
+	}
+
+	wait = bucket.take(now)
+	if wait == 0 {
+		return 0, false
+	}
+
+	if now.Before(bucket.warnedUntil) {
+		return wait, false
+	}
+	bucket.warnedUntil = now.Add(wait)
+	return wait, true
+}
+
+// prune drops buckets that have not been used for a while
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < bucketIdleTimeout {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// outgoingLimiter throttles all messages sent by the bot
+type outgoingLimiter struct {
+	mu          sync.Mutex
+	bucket      *tokenBucket
+	pausedUntil time.Time
+}
+
+func newOutgoingLimiter() *outgoingLimiter {
+	return &outgoingLimiter{bucket: newTokenBucket(outgoingPerSecond, outgoingPerSecond, time.Now())}
+}
+
+// wait blocks until a message may be sent
+func (o *outgoingLimiter) wait() {
+	for {
+		o.mu.Lock()
+		now := time.Now()
+		delay := o.pausedUntil.Sub(now)
+		if delay <= 0 {
+			delay = o.bucket.take(now)
+		}
+		o.mu.Unlock()
+
+		if delay <= 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// pause stops all outgoing messages for the given duration
+func (o *outgoingLimiter) pause(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(o.pausedUntil) {
+		o.pausedUntil = until
+	}
+}
+
+// actionClass returns the rate limit class of the message
+func actionClass(message *tgbotapi.Message) string {
+	if hasAttachment(message) {
+		return config.RateLimitUpload
+	}
+	switch message.Command() {
+	case "list", "show", "groups", "reconcile":
+		return config.RateLimitHeavy
+	}
+	return config.RateLimitCommand
+}
+
+// allowAction checks the sender's rate limit for the message and tells them
+// when to try again if it is exceeded
+func (b *Bot) allowAction(message *tgbotapi.Message) bool {
+	wait, notify := b.limiter.Allow(message.From.ID, actionClass(message))
+	if wait == 0 {
+		return true
+	}
+
+	log.Printf("Rate limit exceeded by %d (%s), retry in %s", message.From.ID, actionClass(message), wait)
+	if notify {
+		seconds := int(wait.Seconds() + 0.999)
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("⏳ Слишком много запросов. Попробуйте снова через %d сек.", seconds))
+		msg.ReplyToMessageID = message.MessageID
+		b.send(msg)
+	}
+	return false
+}
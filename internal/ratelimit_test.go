@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"telegram-bot/config"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		capacity float64
+		rate     float64
+		takes    []time.Duration // times of take() since start
+		want     []time.Duration
+	}{
+		{
+			name:     "burst then wait",
+			capacity: 2, rate: 1,
+			takes: []time.Duration{0, 0, 0},
+			want:  []time.Duration{0, 0, time.Second},
+		},
+		{
+			name:     "partial refill shortens the wait",
+			capacity: 1, rate: 1,
+			takes: []time.Duration{0, 250 * time.Millisecond},
+			want:  []time.Duration{0, 750 * time.Millisecond},
+		},
+		{
+			name:     "refill is capped by capacity",
+			capacity: 2, rate: 1,
+			takes: []time.Duration{0, 0, time.Hour, time.Hour, time.Hour},
+			want:  []time.Duration{0, 0, 0, 0, time.Second},
+		},
+		{
+			name:     "no refill",
+			capacity: 1, rate: 0,
+			takes: []time.Duration{0, time.Hour},
+			want:  []time.Duration{0, time.Hour},
+		},
+		{
+			name:     "clock going back adds nothing",
+			capacity: 1, rate: 1,
+			takes: []time.Duration{time.Minute, 0},
+			want:  []time.Duration{0, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTokenBucket(tt.capacity, tt.rate, start)
+			for i, at := range tt.takes {
+				if got := bucket.take(start.Add(at)); got != tt.want[i] {
+					t.Errorf("take %d at +%s = %s, want %s", i, at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := NewRateLimiter(map[string]config.RateLimit{
+		config.RateLimitUpload:  {Burst: 2, PerMinute: 1},
+		config.RateLimitCommand: {Burst: 0, PerMinute: 1},
+	})
+
+	tests := []struct {
+		name       string
+		userID     int64
+		class      string
+		wantWait   bool
+		wantNotify bool
+	}{
+		{"first in burst", 1, config.RateLimitUpload, false, false},
+		{"second in burst", 1, config.RateLimitUpload, false, false},
+		{"over the limit is reported", 1, config.RateLimitUpload, true, true},
+		{"reported once per wait", 1, config.RateLimitUpload, true, false},
+		{"other user has own bucket", 2, config.RateLimitUpload, false, false},
+		{"zero burst is unlimited", 1, config.RateLimitCommand, false, false},
+		{"unknown class is unlimited", 1, config.RateLimitHeavy, false, false},
+	}
+
+	// Cases run in order: they share the limiter
+	for _, tt := range tests {
+		wait, notify := limiter.Allow(tt.userID, tt.class)
+		if (wait > 0) != tt.wantWait || notify != tt.wantNotify {
+			t.Errorf("%s: Allow = %s, %v; want wait %v, notify %v", tt.name, wait, notify, tt.wantWait, tt.wantNotify)
+		}
+	}
+}
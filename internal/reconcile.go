@@ -0,0 +1,434 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"telegram-bot/config"
+	"telegram-bot/db"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Поля, значения которых сверяются с данными бота
+var reconciledFields = []string{
+	config.SheetFieldUsername,
+	config.SheetFieldFirstName,
+	config.SheetFieldLastName,
+	config.SheetFieldFileName,
+	config.SheetFieldFileType,
+	config.SheetFieldFileSize,
+	config.SheetFieldTeam,
+	config.SheetFieldPosition,
+	config.SheetFieldEmail,
+	config.SheetFieldDepartment,
+}
+
+// Поля, которые берутся из профиля пользователя
+var userSheetFields = map[string]bool{
+	config.SheetFieldUsername:   true,
+	config.SheetFieldFirstName:  true,
+	config.SheetFieldLastName:   true,
+	config.SheetFieldPhone:      true,
+	config.SheetFieldPosition:   true,
+	config.SheetFieldEmployeeID: true,
+	config.SheetFieldEmail:      true,
+	config.SheetFieldDepartment: true,
+	config.SheetFieldHireDate:   true,
+}
+
+// ReconcileReport описывает расхождения между хранилищем файлов и таблицей
+type ReconcileReport struct {
+	DryRun        bool
+	Added         []int64
+	MarkedDeleted []int64
+	Restored      []int64
+	Fixed         []FieldFix
+
+	// Файлы, у которых нашлось несколько строк; лишние строки отмечены дубликатами
+	Duplicates []int64
+
+	// Файлы, события о которых еще ждут записи в очереди; их строки не проверяются
+	Skipped []int64
+}
+
+// pendingWrites - файлы и пользователи, события о которых еще не записаны в таблицу.
+// Сверка их не трогает, иначе очередь записала бы строку второй раз.
+type pendingWrites struct {
+	files map[int64]bool
+	users map[int64]bool
+}
+
+// has сообщает, ждет ли записи событие о файле или обо всех файлах пользователя
+func (p *pendingWrites) has(fileID, userID int64) bool {
+	return p != nil && (p.files[fileID] || p.users[userID])
+}
+
+// FieldFix - исправленное значение ячейки
+type FieldFix struct {
+	FileID int64
+	Field  string
+	Old    string
+	New    string
+}
+
+// Empty сообщает, что расхождений нет
+func (r *ReconcileReport) Empty() bool {
+	return len(r.Added) == 0 && len(r.MarkedDeleted) == 0 && len(r.Restored) == 0 && len(r.Fixed) == 0 &&
+		len(r.Duplicates) == 0
+}
+
+// String форматирует отчет для вывода в консоль или в чат
+func (r *ReconcileReport) String() string {
+	var sb strings.Builder
+	if r.DryRun {
+		sb.WriteString("Сверка таблицы (пробный запуск, изменения не внесены)\n")
+	} else {
+		sb.WriteString("Сверка таблицы\n")
+	}
+
+	if r.Empty() {
+		sb.WriteString("Расхождений не найдено.")
+		if len(r.Skipped) > 0 {
+			sb.WriteString(fmt.Sprintf(" Пропущено файлов, ожидающих записи из очереди: %d.", len(r.Skipped)))
+		}
+		return sb.String()
+	}
+
+	writeIDs := func(title string, ids []int64) {
+		if len(ids) == 0 {
+			return
+		}
+		parts := make([]string, len(ids))
+		for i, id := range ids {
+			parts[i] = fmt.Sprint(id)
+		}
+		sb.WriteString(fmt.Sprintf("%s: %d (ID: %s)\n", title, len(ids), strings.Join(parts, ", ")))
+	}
+	writeIDs("Добавлено строк", r.Added)
+	writeIDs("Отмечено удаленными", r.MarkedDeleted)
+	writeIDs("Восстановлен статус", r.Restored)
+	writeIDs("Отмечены дубликаты строк", r.Duplicates)
+	writeIDs("Пропущено, ожидают записи из очереди", r.Skipped)
+
+	if len(r.Fixed) > 0 {
+		sb.WriteString(fmt.Sprintf("Исправлено значений: %d\n", len(r.Fixed)))
+		for _, fix := range r.Fixed {
+			sb.WriteString(fmt.Sprintf("  файл %d, %s: %q → %q\n", fix.FileID, fix.Field, fix.Old, fix.New))
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Reconcile сверяет таблицу с файлами в хранилище: добавляет недостающие строки,
+// отмечает удаленными строки файлов, которых больше нет, и исправляет устаревшие значения.
+// Если у файла несколько строк, сверяется одна, а остальные отмечаются дубликатами.
+// Файлы из pending пропускаются. В режиме dryRun таблица не изменяется.
+func (s *SheetsService) Reconcile(files []*models.File, users map[int64]*models.User, pending *pendingWrites, dryRun bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{DryRun: dryRun}
+
+	// Читаем все строки листов журнала
+	idColumn := s.columnIndex(config.SheetFieldFileID)
+	statusColumn := s.columnIndex(config.SheetFieldStatus)
+	rows := make(map[int64][]reconciledRow)
+	err := s.scanAllRows(func(tab string, rowNumber int, row []interface{}) {
+		if len(row) <= idColumn {
+			return
+		}
+		if id, ok := cellInt64(row[idColumn]); ok {
+			rows[id] = append(rows[id], reconciledRow{tab: tab, number: rowNumber, values: row})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[int64]bool, len(files))
+	appends := make(map[string][][]interface{})
+	var updates []*sheets.ValueRange
+
+	// primary возвращает строку, которую сверка поддерживает, и отмечает остальные строки файла дубликатами
+	primary := func(fileID int64, tab string) reconciledRow {
+		list := rows[fileID]
+		keep := primaryRow(list, tab, statusColumn)
+		marked := false
+		for i, row := range list {
+			if i == keep || cellString(row.values, statusColumn) == FileStatusDuplicate {
+				continue
+			}
+			marked = true
+			updates = append(updates, s.cellUpdate(config.SheetFieldStatus, row.tab, row.number, FileStatusDuplicate))
+		}
+		if marked {
+			report.Duplicates = append(report.Duplicates, fileID)
+		}
+		return list[keep]
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	for _, file := range files {
+		stored[file.ID] = true
+		if pending.has(file.ID, file.UserID) {
+			report.Skipped = append(report.Skipped, file.ID)
+			continue
+		}
+
+		tab := s.tabName(file)
+		if len(rows[file.ID]) == 0 {
+			// Файла нет в таблице
+			report.Added = append(report.Added, file.ID)
+			appends[tab] = append(appends[tab], s.rowValues(file, users[file.UserID], FileStatusActive))
+			continue
+		}
+		row := primary(file.ID, tab)
+
+		// Файл есть в хранилище, но в таблице отмечен удаленным или дубликатом
+		if status := cellString(row.values, statusColumn); status == FileStatusDeleted || status == FileStatusDuplicate {
+			report.Restored = append(report.Restored, file.ID)
+			updates = append(updates, s.cellUpdate(config.SheetFieldStatus, row.tab, row.number, FileStatusActive))
+		}
+
+		// Сверяем значения полей
+		for _, field := range reconciledFields {
+			column := s.columnIndex(field)
+			if column == -1 {
+				continue
+			}
+			// Данные неизвестного пользователя не трогаем
+			if userSheetFields[field] && users[file.UserID] == nil {
+				continue
+			}
+			expected := fmt.Sprint(fieldValue(field, file, users[file.UserID], FileStatusActive))
+			actual := cellString(row.values, column)
+			if expected != actual {
+				report.Fixed = append(report.Fixed, FieldFix{FileID: file.ID, Field: field, Old: actual, New: expected})
+				updates = append(updates, s.cellUpdate(field, row.tab, row.number,
+					s.cellValue(field, file, users[file.UserID], FileStatusActive)))
+			}
+		}
+	}
+
+	// Строки файлов, которых больше нет в хранилище
+	userColumn := s.columnIndex(config.SheetFieldUserID)
+	var missing []int64
+	for id, list := range rows {
+		if stored[id] {
+			continue
+		}
+		userID, _ := cellInt64(cellValueAt(list[0].values, userColumn))
+		if pending.has(id, userID) {
+			report.Skipped = append(report.Skipped, id)
+			continue
+		}
+		missing = append(missing, id)
+	}
+	sort.Slice(report.Skipped, func(i, j int) bool { return report.Skipped[i] < report.Skipped[j] })
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, id := range missing {
+		row := primary(id, "")
+		if cellString(row.values, statusColumn) != FileStatusDeleted {
+			report.MarkedDeleted = append(report.MarkedDeleted, id)
+			updates = append(updates, s.cellUpdate(config.SheetFieldStatus, row.tab, row.number, FileStatusDeleted))
+		}
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool { return report.Duplicates[i] < report.Duplicates[j] })
+
+	if dryRun || report.Empty() {
+		return report, nil
+	}
+
+	// Вносим изменения
+	if len(updates) > 0 {
+		_, err := s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+			ValueInputOption: "USER_ENTERED",
+			Data:             updates,
+		}).Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to update sheet rows: %w", err)
+		}
+	}
+
+	if len(appends) > 0 {
+		tabs := make([]string, 0, len(appends))
+		for tab := range appends {
+			tabs = append(tabs, tab)
+		}
+		sort.Strings(tabs)
+
+		for _, tab := range tabs {
+			if err := s.ensureTab(tab); err != nil {
+				return nil, err
+			}
+			_, err := s.service.Spreadsheets.Values.Append(
+				s.spreadsheetID,
+				s.a1(tab, fmt.Sprintf("A1:%s1", s.lastColumn())),
+				&sheets.ValueRange{Values: appends[tab]}).
+				ValueInputOption("USER_ENTERED").
+				InsertDataOption("INSERT_ROWS").
+				Do()
+			if err != nil {
+				return nil, fmt.Errorf("unable to append data to sheet: %w", err)
+			}
+		}
+	}
+
+	// Новые строки попадут в индекс, а дубликаты уйдут из него при переиндексации
+	if len(appends) > 0 || len(report.Duplicates) > 0 {
+		if err := s.reindex(); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// reconciledRow - строка листа журнала, прочитанная при сверке
+type reconciledRow struct {
+	tab    string
+	number int
+	values []interface{}
+}
+
+// primaryRow выбирает основную строку файла: не отмеченную дубликатом, по возможности
+// на листе, где файл должен быть сейчас, а иначе первую найденную
+func primaryRow(rows []reconciledRow, tab string, statusColumn int) int {
+	keep := -1
+	for i, row := range rows {
+		if cellString(row.values, statusColumn) == FileStatusDuplicate {
+			continue
+		}
+		if row.tab == tab {
+			return i
+		}
+		if keep == -1 {
+			keep = i
+		}
+	}
+	if keep == -1 {
+		// Все строки отмечены дубликатами: основной становится первая
+		keep = 0
+	}
+	return keep
+}
+
+// cellUpdate создает запись одной ячейки поля в указанной строке листа
+func (s *SheetsService) cellUpdate(field, tab string, rowNumber int, value interface{}) *sheets.ValueRange {
+	return &sheets.ValueRange{
+		Range:  s.a1(tab, fmt.Sprintf("%s%d", s.columnLetterOf(field), rowNumber)),
+		Values: [][]interface{}{{value}},
+	}
+}
+
+// cellString возвращает значение ячейки строкой; целые числа записываются без дробной части
+func cellString(row []interface{}, column int) string {
+	if column < 0 || column >= len(row) || row[column] == nil {
+		return ""
+	}
+	if v, ok := row[column].(float64); ok && v == float64(int64(v)) {
+		return fmt.Sprint(int64(v))
+	}
+	return fmt.Sprint(row[column])
+}
+
+// cellValueAt возвращает ячейку строки или nil, если строка короче
+func cellValueAt(row []interface{}, column int) interface{} {
+	if column < 0 || column >= len(row) {
+		return nil
+	}
+	return row[column]
+}
+
+// reconcile сверяет таблицу с текущим содержимым баз данных.
+// Содержимое файлов не читается: для строк хватает описания и размера.
+func reconcile(s *SheetsService, database *db.DB, dryRun bool) (*ReconcileReport, error) {
+	files, err := database.GetAllFilesInfo()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get files: %w", err)
+	}
+
+	pendingFiles, pendingUsers, err := database.PendingOutboxKeys(s.Name())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read outbox: %w", err)
+	}
+	pending := &pendingWrites{files: pendingFiles, users: pendingUsers}
+
+	userList, err := database.GetAllUsers()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get users: %w", err)
+	}
+	users := make(map[int64]*models.User, len(userList))
+	for _, user := range userList {
+		users[user.ID] = user
+	}
+
+	return s.Reconcile(files, users, pending, dryRun)
+}
+
+// RunReconcile выполняет сверку из командной строки
+func RunReconcile(cfg *config.Config, database *db.DB, dryRun bool) (*ReconcileReport, error) {
+	s, err := NewSheetsService(cfg.Sheets, database)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize Google Sheets: %w", err)
+	}
+
+	// Имя бота нужно для ссылок на файлы в добавляемых строках
+	if api, err := tgbotapi.NewBotAPI(cfg.BotToken); err == nil {
+		s.SetBotUsername(api.Self.UserName)
+	} else {
+		log.Printf("Warning: unable to get bot name, file links will not be written: %v", err)
+	}
+
+	// Размер файлов, сохраненных до его записи, нужен для строк таблицы
+	if _, err := database.BackfillFileSizes(); err != nil {
+		log.Printf("Warning: unable to backfill file sizes: %v", err)
+	}
+
+	return reconcile(s, database, dryRun)
+}
+
+// runReconcileJob периодически сверяет таблицу с хранилищем
+func (b *Bot) runReconcileJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		report, err := reconcile(b.SheetsService, b.DB, false)
+		if err != nil {
+			log.Printf("Error reconciling Google Sheets: %v", err)
+			continue
+		}
+		if !report.Empty() {
+			log.Printf("Google Sheets reconciled:\n%s", report)
+		}
+	}
+}
+
+// handleReconcileCommand запускает сверку по команде администратора.
+// С аргументом "dry" изменения только показываются.
+func (b *Bot) handleReconcileCommand(message *tgbotapi.Message) {
+	if !b.isAdminUser(message.From.ID) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только администраторам."))
+		return
+	}
+	if b.SheetsService == nil {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Google Sheets не подключен."))
+		return
+	}
+
+	dryRun := strings.TrimSpace(message.CommandArguments()) == "dry"
+	b.send(tgbotapi.NewMessage(message.Chat.ID, "⏳ Сверка таблицы с хранилищем..."))
+
+	report, err := reconcile(b.SheetsService, b.DB, dryRun)
+	if err != nil {
+		log.Printf("Error reconciling Google Sheets: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при сверке таблицы."))
+		return
+	}
+
+	b.sendText(message.Chat.ID, report.String())
+}
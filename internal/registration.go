@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"telegram-bot/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Payload of /start deep links with an invite code: t.me/<bot>?start=inv_<code>
+const startPayloadInvite = "inv_"
+
+// refusalText is sent to users who are not allowed to register
+const refusalText = "Извините, бот доступен только сотрудникам компании, и ваш номер не найден в списке. " +
+	"Если у вас есть код приглашения или табельный номер, отправьте его сообщением."
+
+// whitelist holds the phone numbers and employee IDs allowed to register
+type whitelist struct {
+	phones      map[string]bool
+	employeeIDs map[string]bool
+}
+
+// loadWhitelist merges the whitelist from the config with the whitelist file
+func (b *Bot) loadWhitelist() (*whitelist, error) {
+	cfg := b.Config.Registration
+	list := &whitelist{phones: make(map[string]bool), employeeIDs: make(map[string]bool)}
+	for _, phone := range cfg.Phones {
+		list.addPhone(phone)
+	}
+	for _, id := range cfg.EmployeeIDs {
+		list.addEmployeeID(id)
+	}
+
+	if cfg.WhitelistFile == "" {
+		return list, nil
+	}
+	f, err := os.Open(cfg.WhitelistFile)
+	if err != nil {
+		return list, fmt.Errorf("unable to open whitelist: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return list, fmt.Errorf("unable to read whitelist: %w", err)
+		}
+		if strings.EqualFold(record[0], "phone") {
+			continue
+		}
+		list.addPhone(record[0])
+		if len(record) > 1 {
+			list.addEmployeeID(record[1])
+		}
+	}
+	return list, nil
+}
+
+func (w *whitelist) addPhone(phone string) {
+	if phone = normalizePhone(phone); phone != "" {
+		w.phones[phone] = true
+	}
+}
+
+func (w *whitelist) addEmployeeID(id string) {
+	if id = strings.ToUpper(strings.TrimSpace(id)); id != "" {
+		w.employeeIDs[id] = true
+	}
+}
+
+// checkPhone approves a user whose phone number is whitelisted.
+// Otherwise the user is refused and the admins are told about the attempt.
+func (b *Bot) checkPhone(message *tgbotapi.Message, phone string) bool {
+	list, err := b.loadWhitelist()
+	if err != nil {
+		log.Printf("Error loading whitelist: %v", err)
+	}
+	if list.phones[normalizePhone(phone)] {
+		if err := b.DB.ApproveUser(message.From.ID, ""); err != nil {
+			log.Printf("Error approving user: %v", err)
+		}
+		return true
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, refusalText)
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	b.send(msg)
+	b.notifyAdmins(fmt.Sprintf("⚠️ Попытка регистрации: %s (ID: %d), телефон %s. Пользователя нет в списке сотрудников.",
+		senderName(message.From), message.From.ID, phone))
+	return false
+}
+
+// isInviteStart reports whether the message is /start with an invite payload
+func isInviteStart(message *tgbotapi.Message) bool {
+	return message.IsCommand() && message.Command() == "start" &&
+		strings.HasPrefix(message.CommandArguments(), startPayloadInvite)
+}
+
+// handleUnapproved handles a message from a registered user who is not approved yet.
+// The message may carry an invite code or an employee ID.
+func (b *Bot) handleUnapproved(message *tgbotapi.Message, user *models.User) {
+	code := strings.TrimSpace(message.Text)
+	if message.IsCommand() {
+		if message.Command() != "start" {
+			b.send(tgbotapi.NewMessage(message.Chat.ID, refusalText))
+			return
+		}
+		code = strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), startPayloadInvite)
+	}
+	if code == "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, refusalText))
+		return
+	}
+
+	// Invite codes are checked first, then the employee whitelist
+	approved, err := b.DB.RedeemInvite(strings.ToUpper(code), user.ID)
+	if err != nil {
+		log.Printf("Error redeeming invite: %v", err)
+	}
+	employeeID := ""
+	if !approved {
+		approved, employeeID = b.checkEmployeeID(code, user.ID)
+	}
+	if !approved {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Код не подошел. Проверьте его или обратитесь к администратору."))
+		return
+	}
+
+	if err := b.DB.ApproveUser(user.ID, employeeID); err != nil {
+		log.Printf("Error approving user: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при регистрации. Попробуйте позже."))
+		return
+	}
+	log.Printf("User %d approved with code %q", user.ID, code)
+
+	if user.Phone == "" {
+		b.requestPhoneNumber(message.Chat.ID)
+		return
+	}
+	b.send(tgbotapi.NewMessage(message.Chat.ID, "✅ Регистрация завершена. Отправьте /start, чтобы увидеть список команд."))
+}
+
+// checkEmployeeID reports whether the employee ID is whitelisted and not taken by another user
+func (b *Bot) checkEmployeeID(id string, userID int64) (bool, string) {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	list, err := b.loadWhitelist()
+	if err != nil {
+		log.Printf("Error loading whitelist: %v", err)
+	}
+	if !list.employeeIDs[id] {
+		return false, ""
+	}
+
+	owner, err := b.DB.GetUserByEmployeeID(id)
+	if err != nil {
+		log.Printf("Error getting user by employee ID: %v", err)
+		return false, ""
+	}
+	if owner != nil && owner.ID != userID {
+		log.Printf("Warning: user %d tried employee ID %s of user %d", userID, id, owner.ID)
+		return false, ""
+	}
+	return true, id
+}
+
+// handleInviteCommand creates a one-time invite code and sends its deep link
+func (b *Bot) handleInviteCommand(message *tgbotapi.Message) {
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа."))
+		return
+	}
+	if !a.can(models.PermissionManageUsers) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только пользователям с правом управления пользователями."))
+		return
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		log.Printf("Error generating invite code: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при создании приглашения."))
+		return
+	}
+
+	now := time.Now()
+	invite := &models.Invite{
+		Code:      code,
+		CreatedBy: message.From.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(b.Config.Registration.InviteTTLHours) * time.Hour),
+	}
+	if err := b.DB.SaveInvite(invite); err != nil {
+		log.Printf("Error saving invite: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при создании приглашения."))
+		return
+	}
+
+	text := fmt.Sprintf("Приглашение действует до %s и может быть использовано один раз.\n\nСсылка: https://t.me/%s?start=%s%s\nКод: %s",
+		invite.ExpiresAt.Format("02.01.2006 15:04"), b.API.Self.UserName, startPayloadInvite, code, code)
+	b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// newInviteCode returns a random code that is easy to type
+func newInviteCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(buf), nil
+}
+
+// notifyAdmins sends a message to every admin who can be reached
+func (b *Bot) notifyAdmins(text string) {
+	b.notifyAdminsWithButtons(text, nil)
+}
+
+// notifyAdminsWithButtons sends a message with an optional inline keyboard to every active admin
+func (b *Bot) notifyAdminsWithButtons(text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	admins, err := b.DB.GetAdminUsers()
+	if err != nil {
+		log.Printf("Error getting admins: %v", err)
+		return
+	}
+	for _, admin := range admins {
+		if admin.IsActive {
+			msg := tgbotapi.NewMessage(admin.ID, text)
+			if keyboard != nil {
+				msg.ReplyMarkup = *keyboard
+			}
+			b.send(msg)
+		}
+	}
+}
+
+// senderName describes a Telegram user for messages to admins
+func senderName(from *tgbotapi.User) string {
+	name := strings.TrimSpace(from.FirstName + " " + from.LastName)
+	if from.UserName != "" {
+		name += " @" + from.UserName
+	}
+	return name
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"telegram-bot/config"
+	"testing"
+)
+
+func TestLoadWhitelist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "whitelist.csv")
+	err := os.WriteFile(file, []byte("phone,employee_id\n+7 900 111-22-33, e-100\n89002223344\n,E-300\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bot{Config: &config.Config{Registration: config.RegistrationConfig{
+		Phones:        []string{"8 (900) 555-66-77", "не номер"},
+		EmployeeIDs:   []string{" e-200 ", ""},
+		WhitelistFile: file,
+	}}}
+	list, err := b.loadWhitelist()
+	if err != nil {
+		t.Fatalf("loadWhitelist: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		set   map[string]bool
+		key   string
+		found bool
+	}{
+		{"config phone in E.164", list.phones, "+79005556677", true},
+		{"file phone in E.164", list.phones, "+79001112233", true},
+		{"file phone with a leading 8", list.phones, "+79002223344", true},
+		{"header is skipped", list.phones, "phone", false},
+		{"invalid phone is dropped", list.phones, "не номер", false},
+		{"config ID upper-cased and trimmed", list.employeeIDs, "E-200", true},
+		{"file ID upper-cased", list.employeeIDs, "E-100", true},
+		{"file ID without a phone", list.employeeIDs, "E-300", true},
+		{"header ID is skipped", list.employeeIDs, "EMPLOYEE_ID", false},
+	}
+	for _, tt := range tests {
+		if tt.set[tt.key] != tt.found {
+			t.Errorf("%s: %q found = %v, want %v", tt.name, tt.key, tt.set[tt.key], tt.found)
+		}
+	}
+	if len(list.phones) != 3 || len(list.employeeIDs) != 3 {
+		t.Errorf("whitelist has %d phones and %d IDs, want 3 and 3", len(list.phones), len(list.employeeIDs))
+	}
+
+	// A missing file is an error, but the config whitelist still applies
+	b.Config.Registration.WhitelistFile = filepath.Join(t.TempDir(), "missing.csv")
+	list, err = b.loadWhitelist()
+	if err == nil || !list.phones["+79005556677"] {
+		t.Errorf("loadWhitelist with a missing file = %v, %v", list.phones, err)
+	}
+}
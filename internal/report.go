@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"telegram-bot/config"
+	"telegram-bot/models"
+	"time"
+)
+
+// Report event types
+const (
+	EventUpload    = "upload"
+	EventDelete    = "delete"
+	EventDeleteAll = "delete_all"
+	EventRestore   = "restore"
+
+	// The file was handed over to another user; the event carries the new owner
+	EventReassign = "reassign"
+
+	// The personal data of a user was erased; only the user ID is set
+	EventErase = "erase"
+
+	// The user left the company; the event carries the user but no file
+	EventOffboard = "offboard"
+)
+
+// eventLabels are the event names written to spreadsheet-style logs
+var eventLabels = map[string]string{
+	EventUpload:    "Загрузка",
+	EventDelete:    "Удаление",
+	EventDeleteAll: "Удаление всех файлов",
+	EventRestore:   "Восстановление",
+	EventReassign:  "Передача файла",
+	EventErase:     "Удаление персональных данных",
+	EventOffboard:  "Увольнение сотрудника",
+}
+
+// ReportEvent describes a change in stored files or their owner.
+// File fields are empty for delete_all, erase and offboard events.
+type ReportEvent struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	FileID    int64     `json:"file_id,omitempty"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name,omitempty"`
+	LastName  string    `json:"last_name,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	Team      string    `json:"team,omitempty"`
+	FileName  string    `json:"file_name,omitempty"`
+	FileType  string    `json:"file_type,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	// Profile of the uploader, filled in when the event is delivered
+	Position   string    `json:"position,omitempty"`
+	EmployeeID string    `json:"employee_id,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Department string    `json:"department,omitempty"`
+	HireDate   time.Time `json:"hire_date,omitempty"`
+	Offboarded bool      `json:"offboarded,omitempty"`
+}
+
+// ReportSink receives report events. Report is called from the outbox worker
+// and may fail; the event is then retried later.
+type ReportSink interface {
+	// Name identifies the sink in the outbox and must not change between restarts
+	Name() string
+	Report(event *ReportEvent) error
+}
+
+// BatchSink is a sink that can write several events in one go. The batch either
+// succeeds or fails as a whole.
+type BatchSink interface {
+	ReportSink
+	ReportBatch(events []*ReportEvent) error
+}
+
+// newReportSinks creates the sinks enabled in the configuration
+func newReportSinks(cfg *config.Config, sheetsService *SheetsService) []ReportSink {
+	var sinks []ReportSink
+
+	if sheetsService != nil {
+		sinks = append(sinks, sheetsService)
+	}
+	if cfg.Reports.CSVFile != "" {
+		sinks = append(sinks, newCSVSink(cfg.Reports.CSVFile))
+	}
+	if cfg.Reports.XLSXFile != "" {
+		sinks = append(sinks, newXLSXSink(cfg.Reports.XLSXFile))
+	}
+	for _, webhook := range cfg.Reports.Webhooks {
+		if webhook.URL == "" {
+			log.Printf("Warning: webhook without URL ignored")
+			continue
+		}
+		sinks = append(sinks, newWebhookSink(webhook))
+	}
+
+	return sinks
+}
+
+// fileEvent creates an event about a single file
+func fileEvent(eventType string, file *models.File, username string) *ReportEvent {
+	return &ReportEvent{
+		Type:      eventType,
+		Time:      time.Now(),
+		FileID:    file.ID,
+		UserID:    file.UserID,
+		Username:  username,
+		Team:      file.Team,
+		FileName:  file.FileName,
+		FileType:  file.FileType,
+		Size:      file.Size,
+		CreatedAt: file.CreatedAt,
+	}
+}
+
+// ownerUsername returns the username written to reports for the owner of files.
+// Events carry the owner's name even when someone else, such as a manager, acted.
+func (b *Bot) ownerUsername(userID int64) string {
+	user, err := b.DB.GetUser(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+	}
+	if user == nil {
+		return ""
+	}
+	return user.Username
+}
+
+// file returns the file described by the event
+func (e *ReportEvent) file() *models.File {
+	return &models.File{
+		ID:        e.FileID,
+		UserID:    e.UserID,
+		Team:      e.Team,
+		FileName:  e.FileName,
+		FileType:  e.FileType,
+		Size:      e.Size,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// user returns the uploader described by the event
+func (e *ReportEvent) user() *models.User {
+	return &models.User{
+		ID:         e.UserID,
+		Username:   e.Username,
+		FirstName:  e.FirstName,
+		LastName:   e.LastName,
+		Phone:      e.Phone,
+		Position:   e.Position,
+		EmployeeID: e.EmployeeID,
+		Email:      e.Email,
+		Department: e.Department,
+		HireDate:   e.HireDate,
+		Offboarded: e.Offboarded,
+	}
+}
+
+// logRow returns the event as a row of the CSV and XLSX logs
+func (e *ReportEvent) logRow() []string {
+	row := []string{
+		e.Time.Format("2006-01-02 15:04:05"),
+		eventLabels[e.Type],
+		"",
+		fmt.Sprint(e.UserID),
+		e.Username,
+		e.Team,
+		e.FileName,
+		e.FileType,
+		"",
+	}
+	if e.FileID != 0 {
+		row[2] = fmt.Sprint(e.FileID)
+	}
+	if e.Size != 0 {
+		row[8] = fmt.Sprint(e.Size)
+	}
+	return row
+}
+
+// Columns of the CSV and XLSX logs with personal data: username, team and file name
+var logPersonalColumns = []int{4, 5, 6}
+
+// redactLogRow erases the personal data of a user from a row of the CSV and XLSX logs.
+// The time, the event and the IDs stay. It reports whether the row was about the user.
+func redactLogRow(row []string, userID int64) bool {
+	if len(row) < len(logHeader) || row[3] != fmt.Sprint(userID) {
+		return false
+	}
+	for _, column := range logPersonalColumns {
+		row[column] = ""
+	}
+	row[4] = anonymizedUsername
+	return true
+}
+
+// logHeader is the header row of the CSV and XLSX logs
+var logHeader = []string{
+	"Дата и время",
+	"Событие",
+	"ID файла",
+	"ID пользователя",
+	"Имя пользователя",
+	"Команда",
+	"Имя файла",
+	"Тип файла",
+	"Размер файла",
+}
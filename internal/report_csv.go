@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// csvSink appends report events to a CSV file
+type csvSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newCSVSink(path string) *csvSink {
+	return &csvSink{path: path}
+}
+
+func (s *csvSink) Name() string {
+	return "csv"
+}
+
+// Report appends the event as one row. The file is opened for every event
+// so it can be rotated or removed while the bot is running. Erasing a user's
+// data first erases it from the earlier rows.
+func (s *csvSink) Report(event *ReportEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.Type == EventErase {
+		if err := s.redactUser(event.UserID); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("unable to create report directory: %v", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open CSV report: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to open CSV report: %v", err)
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(logHeader)
+	}
+	w.Write(event.logRow())
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("unable to write CSV report: %v", err)
+	}
+	return nil
+}
+
+// redactUser rewrites the file without the personal data of the user
+func (s *csvSink) redactUser(userID int64) error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open CSV report: %v", err)
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read CSV report: %v", err)
+	}
+
+	changed := false
+	for _, record := range records {
+		if redactLogRow(record, userID) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	// The file is replaced at once so a crash does not leave half of it
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".report-*")
+	if err != nil {
+		return fmt.Errorf("unable to rewrite CSV report: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := csv.NewWriter(tmp)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to rewrite CSV report: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to rewrite CSV report: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("unable to rewrite CSV report: %v", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCSVSinkErase(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		events []*ReportEvent
+		want   [][]string
+	}{
+		{
+			name: "rows of the user are redacted",
+			events: []*ReportEvent{
+				{Type: EventUpload, Time: at, FileID: 1, UserID: 10, Username: "ivanov", Team: "Sales", FileName: "a.pdf", FileType: "application/pdf", Size: 5},
+				{Type: EventUpload, Time: at, FileID: 2, UserID: 20, Username: "petrov", Team: "Sales", FileName: "b.pdf", FileType: "application/pdf", Size: 7},
+				{Type: EventErase, Time: at, UserID: 10},
+			},
+			want: [][]string{
+				logHeader,
+				{"2026-10-01 12:00:00", "Загрузка", "1", "10", anonymizedUsername, "", "", "application/pdf", "5"},
+				{"2026-10-01 12:00:00", "Загрузка", "2", "20", "petrov", "Sales", "b.pdf", "application/pdf", "7"},
+				{"2026-10-01 12:00:00", "Удаление персональных данных", "", "10", "", "", "", "", ""},
+			},
+		},
+		{
+			name:   "erase before any event",
+			events: []*ReportEvent{{Type: EventErase, Time: at, UserID: 10}},
+			want: [][]string{
+				logHeader,
+				{"2026-10-01 12:00:00", "Удаление персональных данных", "", "10", "", "", "", "", ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "files.csv")
+			sink := newCSVSink(path)
+			for _, event := range tt.events {
+				if err := sink.Report(event); err != nil {
+					t.Fatalf("Report(%s): %v", event.Type, err)
+				}
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer f.Close()
+			got, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"telegram-bot/config"
+	"time"
+)
+
+// Timeout of a single webhook request
+const webhookTimeout = 10 * time.Second
+
+// webhookSink posts report events as JSON to an HTTP endpoint
+type webhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func newWebhookSink(cfg config.WebhookConfig) *webhookSink {
+	return &webhookSink{
+		url:    cfg.URL,
+		secret: []byte(cfg.Secret),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Name includes the URL so every webhook keeps its own outbox entries
+func (s *webhookSink) Name() string {
+	return "webhook:" + s.url
+}
+
+// Report posts the event. With a secret, the request carries the headers
+// X-Webhook-Timestamp and X-Webhook-Signature: "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the request body.
+func (s *webhookSink) Report(event *ReportEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+
+	if len(s.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+s.sign(timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("webhook returned %s: %w", resp.Status, errRateLimited)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sign computes the request signature
+func (s *webhookSink) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Name of the worksheet with report events
+const xlsxSheetName = "Журнал"
+
+// xlsxSink appends report events to local XLSX workbooks, one per month of events.
+// The workbook is rewritten on every save, so keeping it to a month bounds the cost.
+type xlsxSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newXLSXSink(path string) *xlsxSink {
+	return &xlsxSink{path: path}
+}
+
+func (s *xlsxSink) Name() string {
+	return "xlsx"
+}
+
+// Report appends the event as a row of the log sheet. The workbook is created on the first event.
+func (s *xlsxSink) Report(event *ReportEvent) error {
+	return s.ReportBatch([]*ReportEvent{event})
+}
+
+// ReportBatch appends the events with one open and one save of each workbook they go to.
+// Erasing a user's data first erases it from the earlier rows of all workbooks.
+func (s *xlsxSink) ReportBatch(events []*ReportEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	byPath := make(map[string][]*ReportEvent)
+	for _, event := range events {
+		if event.Type == EventErase {
+			if err := s.redactUser(event.UserID); err != nil {
+				return err
+			}
+		}
+		path := s.monthPath(event.Time)
+		if _, ok := byPath[path]; !ok {
+			paths = append(paths, path)
+		}
+		byPath[path] = append(byPath[path], event)
+	}
+
+	for _, path := range paths {
+		if err := s.appendRows(path, byPath[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// monthPath returns the workbook of the month: reports/files.xlsx becomes reports/files_2026-10.xlsx
+func (s *xlsxSink) monthPath(t time.Time) string {
+	ext := filepath.Ext(s.path)
+	return fmt.Sprintf("%s_%s%s", strings.TrimSuffix(s.path, ext), t.Local().Format("2006-01"), ext)
+}
+
+// redactUser erases the personal data of the user from the monthly workbooks and
+// from a workbook kept at the configured path by earlier versions
+func (s *xlsxSink) redactUser(userID int64) error {
+	ext := filepath.Ext(s.path)
+	paths, err := filepath.Glob(strings.TrimSuffix(s.path, ext) + "_*" + ext)
+	if err != nil {
+		return err
+	}
+	for _, path := range append(paths, s.path) {
+		if err := redactXLSX(path, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactXLSX erases the personal data of the user from one workbook, if it exists
+func redactXLSX(path string, userID int64) error {
+	f, err := excelize.OpenFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open XLSX report: %v", err)
+	}
+	defer f.Close()
+
+	// Other workbooks matching the name are left alone
+	if index, _ := f.GetSheetIndex(xlsxSheetName); index == -1 {
+		return nil
+	}
+	// Raw values keep large user IDs from being shown in exponent form
+	rows, err := f.GetRows(xlsxSheetName, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return fmt.Errorf("unable to read XLSX report: %v", err)
+	}
+
+	changed := false
+	for i, row := range rows {
+		// Trailing empty cells are not returned
+		for len(row) < len(logHeader) {
+			row = append(row, "")
+		}
+		if !redactLogRow(row, userID) {
+			continue
+		}
+		changed = true
+		for _, column := range logPersonalColumns {
+			cell, err := excelize.CoordinatesToCellName(column+1, i+1)
+			if err != nil {
+				return err
+			}
+			if err := f.SetCellValue(xlsxSheetName, cell, row[column]); err != nil {
+				return fmt.Errorf("unable to write XLSX report: %v", err)
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveXLSX(f, path)
+}
+
+// appendRows adds the events to the end of the workbook and saves it
+func (s *xlsxSink) appendRows(path string, events []*ReportEvent) error {
+	f, err := openXLSXLog(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(xlsxSheetName)
+	if err != nil {
+		return fmt.Errorf("unable to read XLSX report: %v", err)
+	}
+
+	for i, event := range events {
+		cell, err := excelize.CoordinatesToCellName(1, len(rows)+1+i)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(xlsxSheetName, cell, xlsxRow(event.logRow())); err != nil {
+			return fmt.Errorf("unable to write XLSX report: %v", err)
+		}
+	}
+	return saveXLSX(f, path)
+}
+
+// saveXLSX writes the workbook to a temporary file first so a crash does not leave a broken workbook
+func saveXLSX(f *excelize.File, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".report-*")
+	if err != nil {
+		return fmt.Errorf("unable to save XLSX report: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to save XLSX report: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to save XLSX report: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// openXLSXLog opens a workbook, creating it with a header row if it does not exist
+func openXLSXLog(path string) (*excelize.File, error) {
+	f, err := excelize.OpenFile(path)
+	if err == nil {
+		if index, _ := f.GetSheetIndex(xlsxSheetName); index == -1 {
+			if _, err := f.NewSheet(xlsxSheetName); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("unable to create XLSX sheet: %v", err)
+			}
+		}
+		return f, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unable to open XLSX report: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create report directory: %v", err)
+	}
+
+	f = excelize.NewFile()
+	if err := f.SetSheetName(f.GetSheetName(0), xlsxSheetName); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.SetSheetRow(xlsxSheetName, "A1", xlsxRow(logHeader)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.SetPanes(xlsxSheetName, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	return f, nil
+}
+
+// Columns of logRow stored as numbers: file ID, user ID and size.
+// Names and other text stay strings even when they look like numbers.
+var xlsxNumericColumns = map[int]bool{2: true, 3: true, 8: true}
+
+// xlsxRow converts a log row to cell values; the ID and size columns are stored as numbers
+func xlsxRow(row []string) *[]interface{} {
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		values[i] = value
+		if !xlsxNumericColumns[i] {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			values[i] = n
+		}
+	}
+	return &values
+}
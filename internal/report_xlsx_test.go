@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *ReportEvent
+		want  []interface{}
+	}{
+		{
+			name: "upload",
+			event: &ReportEvent{Type: EventUpload, FileID: 7, UserID: 70, Username: "ivanov", Team: "Sales",
+				FileName: "a.pdf", FileType: "application/pdf", Size: 1024},
+			want: []interface{}{"Загрузка", int64(7), int64(70), "ivanov", "Sales", "a.pdf", "application/pdf", int64(1024)},
+		},
+		{
+			name: "numeric names stay text",
+			event: &ReportEvent{Type: EventUpload, FileID: 7, UserID: 70, Username: "2024", Team: "007",
+				FileName: "12345678901234567890", Size: 1},
+			want: []interface{}{"Загрузка", int64(7), int64(70), "2024", "007", "12345678901234567890", "", int64(1)},
+		},
+		{
+			name:  "event without a file",
+			event: &ReportEvent{Type: EventDeleteAll, UserID: 70},
+			want:  []interface{}{"Удаление всех файлов", "", int64(70), "", "", "", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.Time = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+			got := *xlsxRow(tt.event.logRow())
+			if got[0] != "2026-10-01 12:00:00" {
+				t.Errorf("time cell %v", got[0])
+			}
+			if !reflect.DeepEqual(got[1:], tt.want) {
+				t.Errorf("xlsxRow = %#v, want %#v", got[1:], tt.want)
+			}
+		})
+	}
+}
+
+func TestXLSXSinkMonthlyWorkbooks(t *testing.T) {
+	dir := t.TempDir()
+	sink := newXLSXSink(filepath.Join(dir, "reports", "files.xlsx"))
+
+	september := time.Date(2026, 9, 30, 12, 0, 0, 0, time.Local)
+	october := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	events := []*ReportEvent{
+		{Type: EventUpload, Time: september, FileID: 1, UserID: 10},
+		{Type: EventUpload, Time: october, FileID: 2, UserID: 10},
+		{Type: EventDelete, Time: september, FileID: 1, UserID: 10},
+	}
+	if err := sink.ReportBatch(events); err != nil {
+		t.Fatalf("ReportBatch: %v", err)
+	}
+	if err := sink.Report(&ReportEvent{Type: EventRestore, Time: october, FileID: 1, UserID: 10}); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wantIDs []string
+	}{
+		{"files_2026-09.xlsx", []string{"1", "1"}},
+		{"files_2026-10.xlsx", []string{"2", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := excelize.OpenFile(filepath.Join(dir, "reports", tt.name))
+			if err != nil {
+				t.Fatalf("OpenFile: %v", err)
+			}
+			defer f.Close()
+
+			rows, err := f.GetRows(xlsxSheetName)
+			if err != nil {
+				t.Fatalf("GetRows: %v", err)
+			}
+			if len(rows) != len(tt.wantIDs)+1 || rows[0][0] != logHeader[0] {
+				t.Fatalf("rows = %v, want header and %d events", rows, len(tt.wantIDs))
+			}
+			for i, id := range tt.wantIDs {
+				if rows[i+1][2] != id {
+					t.Errorf("row %d: file ID %q, want %q", i+1, rows[i+1][2], id)
+				}
+			}
+		})
+	}
+}
+
+func TestXLSXSinkErase(t *testing.T) {
+	dir := t.TempDir()
+	sink := newXLSXSink(filepath.Join(dir, "files.xlsx"))
+
+	september := time.Date(2026, 9, 30, 12, 0, 0, 0, time.Local)
+	october := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	err := sink.ReportBatch([]*ReportEvent{
+		{Type: EventUpload, Time: september, FileID: 1, UserID: 6000000000, Username: "ivanov", Team: "Sales", FileName: "a.pdf"},
+		{Type: EventUpload, Time: october, FileID: 2, UserID: 20, Username: "petrov", Team: "Sales", FileName: "b.pdf"},
+		{Type: EventUpload, Time: october, FileID: 3, UserID: 6000000000, Username: "ivanov", FileName: "c.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("ReportBatch: %v", err)
+	}
+	if err := sink.Report(&ReportEvent{Type: EventErase, Time: october, UserID: 6000000000}); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	tests := []struct {
+		workbook string
+		row      int
+		want     []string
+	}{
+		{"files_2026-09.xlsx", 1, []string{anonymizedUsername, "", ""}},
+		{"files_2026-10.xlsx", 1, []string{"petrov", "Sales", "b.pdf"}},
+		{"files_2026-10.xlsx", 2, []string{anonymizedUsername, "", ""}},
+	}
+	for _, tt := range tests {
+		f, err := excelize.OpenFile(filepath.Join(dir, tt.workbook))
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		rows, err := f.GetRows(xlsxSheetName)
+		f.Close()
+		if err != nil {
+			t.Fatalf("GetRows: %v", err)
+		}
+		row := append(rows[tt.row], make([]string, len(logHeader))...)
+		if got := row[4:7]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s row %d: personal cells %q, want %q", tt.workbook, tt.row, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"telegram-bot/config"
+	"telegram-bot/models"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Review decisions stored with a file
+const (
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+	ReviewDelete   = "delete"
+)
+
+// reviewLabels are written to the review column for stored decisions
+var reviewLabels = map[string]string{
+	ReviewApproved: "Approved",
+	ReviewRejected: "Rejected",
+}
+
+// reviewWords maps what managers type in the review column to decisions
+var reviewWords = map[string]string{
+	"approved":  ReviewApproved,
+	"approve":   ReviewApproved,
+	"одобрено":  ReviewApproved,
+	"одобрен":   ReviewApproved,
+	"rejected":  ReviewRejected,
+	"reject":    ReviewRejected,
+	"отклонено": ReviewRejected,
+	"отклонен":  ReviewRejected,
+	"delete":    ReviewDelete,
+	"удалить":   ReviewDelete,
+}
+
+// SheetReview is the content of the review columns of one row
+type SheetReview struct {
+	FileID  int64
+	Value   string
+	Comment string
+}
+
+// HasReviewColumn reports whether the spreadsheet layout has a review column
+func (s *SheetsService) HasReviewColumn() bool {
+	return s.columnIndex(config.SheetFieldReview) != -1
+}
+
+// ReadReviews reads all rows with a filled review column
+func (s *SheetsService) ReadReviews() ([]SheetReview, error) {
+	idColumn := s.columnIndex(config.SheetFieldFileID)
+	reviewColumn := s.columnIndex(config.SheetFieldReview)
+	commentColumn := s.columnIndex(config.SheetFieldReviewComment)
+
+	var reviews []SheetReview
+	err := s.scanAllRows(func(tab string, rowNumber int, row []interface{}) {
+		value := strings.TrimSpace(cellString(row, reviewColumn))
+		if value == "" || len(row) <= idColumn {
+			return
+		}
+		fileID, ok := cellInt64(row[idColumn])
+		if !ok {
+			return
+		}
+		reviews = append(reviews, SheetReview{
+			FileID:  fileID,
+			Value:   value,
+			Comment: strings.TrimSpace(cellString(row, commentColumn)),
+		})
+	})
+	return reviews, err
+}
+
+// parseReview turns the review cell into a decision. A comment may follow the decision
+// in the same cell ("Rejected: no signature") or come from the comment column.
+func parseReview(value, comment string) (string, string, bool) {
+	word, rest := value, ""
+	if i := strings.IndexAny(value, ":-—"); i >= 0 {
+		_, size := utf8.DecodeRuneInString(value[i:])
+		word, rest = value[:i], strings.TrimSpace(value[i+size:])
+	}
+
+	decision, ok := reviewWords[strings.ToLower(strings.TrimSpace(word))]
+	if !ok {
+		return "", "", false
+	}
+	if comment == "" {
+		comment = rest
+	}
+	return decision, comment, true
+}
+
+// runReviewPoller periodically applies review decisions made in the spreadsheet
+func (b *Bot) runReviewPoller(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		b.pollReviews()
+	}
+}
+
+// pollReviews applies new review decisions from the spreadsheet
+func (b *Bot) pollReviews() {
+	reviews, err := b.SheetsService.ReadReviews()
+	if err != nil {
+		log.Printf("Error reading reviews from Google Sheets: %v", err)
+		return
+	}
+
+	for _, review := range reviews {
+		decision, comment, ok := parseReview(review.Value, review.Comment)
+		if !ok {
+			continue
+		}
+
+		file, err := b.DB.GetFileInfo(review.FileID)
+		if err != nil {
+			log.Printf("Error getting file %d: %v", review.FileID, err)
+			continue
+		}
+		// Deleted files and decisions that were already applied are skipped
+		if file == nil || (file.Review == decision && file.ReviewComment == comment) {
+			continue
+		}
+
+		b.applyReview(file, decision, comment)
+	}
+}
+
+// applyReview updates the file according to the manager's decision and notifies the uploader
+func (b *Bot) applyReview(file *models.File, decision, comment string) {
+	var text string
+
+	switch decision {
+	case ReviewApproved, ReviewRejected:
+		if err := b.DB.UpdateFileReview(file.ID, decision, comment, time.Now()); err != nil {
+			log.Printf("Error saving review of file %d: %v", file.ID, err)
+			return
+		}
+
+		if decision == ReviewApproved {
+			text = fmt.Sprintf("✅ Ваш файл «%s» (ID: %d) одобрен.", file.FileName, file.ID)
+		} else {
+			text = fmt.Sprintf("❌ Ваш файл «%s» (ID: %d) отклонен.", file.FileName, file.ID)
+		}
+		if comment != "" {
+			text += "\nКомментарий: " + comment
+		}
+
+	case ReviewDelete:
+		if err := b.DB.DeleteFile(file.ID); err != nil {
+			log.Printf("Error deleting file %d: %v", file.ID, err)
+			return
+		}
+		b.report(fileEvent(EventDelete, file, b.ownerUsername(file.UserID)))
+
+		text = fmt.Sprintf("🗑 Ваш файл «%s» (ID: %d) удален по решению руководителя.", file.FileName, file.ID)
+		if comment != "" {
+			text += "\nКомментарий: " + comment
+		}
+	}
+
+	log.Printf("Review of file %d applied: %s", file.ID, decision)
+	b.send(tgbotapi.NewMessage(file.UserID, text))
+}
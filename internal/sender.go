@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Maximum length of a text message in UTF-16 code units
+	maxMessageLength = 4096
+
+	// How many times a message is resent after a flood wait or a network error
+	maxSendRetries = 3
+
+	// Delay before the first resend after a network error, doubled on every attempt
+	sendInitialBackoff = time.Second
+)
+
+// sendErrorKind classifies errors returned when sending to Telegram
+type sendErrorKind int
+
+const (
+	sendErrorOther     sendErrorKind = iota
+	sendErrorFloodWait               // 429: too many requests, retry after a delay
+	sendErrorBlocked                 // 403: the user blocked the bot or deleted the account
+	sendErrorTooLong                 // 400: message text is too long
+	sendErrorTransient               // network failures and Telegram server errors
+)
+
+// classifySendError determines how a failed send should be handled
+func classifySendError(err error) sendErrorKind {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		// No response from Telegram at all
+		return sendErrorTransient
+	}
+
+	switch {
+	case tgErr.Code == 429:
+		return sendErrorFloodWait
+	case tgErr.Code == 403:
+		return sendErrorBlocked
+	case tgErr.Code == 400 && strings.Contains(strings.ToLower(tgErr.Message), "too long"):
+		return sendErrorTooLong
+	case tgErr.Code >= 500:
+		return sendErrorTransient
+	}
+	return sendErrorOther
+}
+
+// send sends a message through the global outgoing limiter.
+// Flood waits and network errors are retried, users who blocked the bot are marked
+// inactive and text messages over the length limit are split into parts.
+func (b *Bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	backoff := sendInitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		b.outgoing.wait()
+
+		msg, err := b.API.Send(c)
+		if err == nil {
+			return msg, nil
+		}
+
+		switch classifySendError(err) {
+		case sendErrorFloodWait:
+			if attempt < maxSendRetries {
+				var tgErr *tgbotapi.Error
+				errors.As(err, &tgErr)
+				retryAfter := time.Duration(tgErr.RetryAfter) * time.Second
+				if retryAfter <= 0 {
+					retryAfter = time.Second
+				}
+				b.outgoing.pause(retryAfter)
+				continue
+			}
+
+		case sendErrorTransient:
+			if attempt < maxSendRetries {
+				time.Sleep(backoff)
+				backoff *= 2
+				continue
+			}
+
+		case sendErrorBlocked:
+			b.markUserInactive(chatIDOf(c))
+
+		case sendErrorTooLong:
+			if message, ok := c.(tgbotapi.MessageConfig); ok && utf16Len(message.Text) > maxMessageLength {
+				return b.sendLong(message)
+			}
+		}
+
+		log.Printf("Error sending to chat %d: %v", chatIDOf(c), err)
+		return msg, err
+	}
+}
+
+// sendText sends a text message, splitting it into several messages if it is too long
+func (b *Bot) sendText(chatID int64, text string) (tgbotapi.Message, error) {
+	return b.sendLong(tgbotapi.NewMessage(chatID, text))
+}
+
+// sendLong sends a text message in parts that fit into the length limit.
+// The reply markup is attached to the last part.
+func (b *Bot) sendLong(message tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	parts := splitMessage(message.Text, maxMessageLength)
+
+	var last tgbotapi.Message
+	for i, part := range parts {
+		msg := message
+		msg.Text = part
+		if i < len(parts)-1 {
+			msg.ReplyMarkup = nil
+		}
+
+		sent, err := b.send(msg)
+		if err != nil {
+			return sent, err
+		}
+		last = sent
+	}
+	return last, nil
+}
+
+// splitMessage splits text into parts of at most limit UTF-16 code units,
+// preferring to break at line ends
+func splitMessage(text string, limit int) []string {
+	if utf16Len(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var current strings.Builder
+	currentLen := 0
+
+	flush := func() {
+		if current.Len() > 0 {
+			parts = append(parts, current.String())
+			current.Reset()
+			currentLen = 0
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		lineLen := utf16Len(line)
+		if currentLen+lineLen > limit {
+			flush()
+		}
+
+		// A single line longer than the limit is cut by characters
+		for lineLen > limit {
+			head, tail := cutUTF16(line, limit)
+			parts = append(parts, head)
+			line = tail
+			lineLen = utf16Len(line)
+		}
+
+		current.WriteString(line)
+		currentLen += lineLen
+	}
+	flush()
+
+	return parts
+}
+
+// utf16Len returns the length of s in UTF-16 code units, as Telegram counts it
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// cutUTF16 splits s after at most limit UTF-16 code units without breaking a character.
+// The head holds at least one character, so a limit below two still makes progress.
+func cutUTF16(s string, limit int) (string, string) {
+	n := 0
+	for i, r := range s {
+		size := utf16.RuneLen(r)
+		if n+size > limit && i > 0 {
+			return s[:i], s[i:]
+		}
+		n += size
+	}
+	return s, ""
+}
+
+// chatIDOf returns the chat a message is addressed to
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	switch m := c.(type) {
+	case tgbotapi.MessageConfig:
+		return m.ChatID
+	case tgbotapi.PhotoConfig:
+		return m.ChatID
+	case tgbotapi.VideoConfig:
+		return m.ChatID
+	case tgbotapi.AudioConfig:
+		return m.ChatID
+	case tgbotapi.DocumentConfig:
+		return m.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return m.ChatID
+	case tgbotapi.ChatActionConfig:
+		return m.ChatID
+	}
+	return 0
+}
+
+// markUserInactive records that a user can no longer receive messages from the bot
+func (b *Bot) markUserInactive(chatID int64) {
+	// Private chat IDs are positive and equal to the user ID
+	if chatID <= 0 {
+		return
+	}
+
+	if err := b.DB.SetUserActive(chatID, false); err != nil {
+		log.Printf("Error marking user %d inactive: %v", chatID, err)
+		return
+	}
+	log.Printf("User %d blocked the bot and was marked inactive", chatID)
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"fits", "привет", 6, []string{"привет"}},
+		{"empty", "", 4, []string{""}},
+		{"breaks at line ends", "aaa\nbbb\nccc", 8, []string{"aaa\nbbb\n", "ccc"}},
+		{"long line is cut", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"long line after short one", "ab\ncdefgh", 4, []string{"ab\n", "cdef", "gh"}},
+		{"cyrillic is one unit", "абвгд", 2, []string{"аб", "вг", "д"}},
+		{"surrogate pair is not broken", "😀😀😀", 3, []string{"😀", "😀", "😀"}},
+		{"surrogate pairs fill the limit", "😀😀😀", 4, []string{"😀😀", "😀"}},
+		{"limit below a surrogate pair", "😀a", 1, []string{"😀", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+			if joined := strings.Join(got, ""); joined != tt.text {
+				t.Errorf("parts join to %q, want %q", joined, tt.text)
+			}
+		})
+	}
+}
+
+func TestSplitMessageLimit(t *testing.T) {
+	text := strings.Repeat("строка с эмодзи 😀\n", 500) + strings.Repeat("😀", 3000)
+	for i, part := range splitMessage(text, maxMessageLength) {
+		if n := utf16Len(part); n > maxMessageLength {
+			t.Errorf("part %d is %d UTF-16 units long", i, n)
+		}
+	}
+}
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want sendErrorKind
+	}{
+		{"no response", errors.New("connection reset"), sendErrorTransient},
+		{"flood wait", &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5"}, sendErrorFloodWait},
+		{"blocked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, sendErrorBlocked},
+		{"too long", &tgbotapi.Error{Code: 400, Message: "Bad Request: message is too long"}, sendErrorTooLong},
+		{"other bad request", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, sendErrorOther},
+		{"server error", &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, sendErrorTransient},
+		{"wrapped", fmt.Errorf("send: %w", &tgbotapi.Error{Code: 403}), sendErrorBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifySendError(tt.err); got != tt.want {
+				t.Errorf("classifySendError(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
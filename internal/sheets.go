@@ -2,309 +2,770 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"telegram-bot/config"
+	"telegram-bot/db"
 	"telegram-bot/models"
 
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
 const (
-	// ID таблицы Google Sheets
-	spreadsheetID = "13KIfRMTePI4djpi6W4pm6WKaE0I9sTA4-LPkesS724I"
-
-	// Диапазон для записи данных (лист и диапазон)
-	readRange = "Лист1!A1:Z1000"
-
 	// Статусы файлов
-	FileStatusActive  = "Активен"
-	FileStatusDeleted = "Удален"
+	FileStatusActive    = "Активен"
+	FileStatusDeleted   = "Удален"
+	FileStatusDuplicate = "Дубликат" // лишняя строка файла, у которого есть основная строка
+
+	// Количество строк, читаемых из таблицы за один запрос
+	sheetPageSize = 1000
 )
 
+// Поля, без которых сервис не может находить и обновлять строки
+var requiredSheetFields = []string{
+	config.SheetFieldFileID,
+	config.SheetFieldUserID,
+	config.SheetFieldStatus,
+}
+
 // SheetsService представляет сервис для работы с Google Sheets
 type SheetsService struct {
-	service *sheets.Service
+	service       *sheets.Service
+	db            *db.DB
+	spreadsheetID string
+	sheetTemplate string
+	tabPattern    *regexp.Regexp
+	summarySheet  string
+	staffSheet    string
+	staffPhones   bool
+	columns       []config.SheetColumn
+	botUsername   string
+
+	// Существующие листы, листы с проверенными заголовками и с выделением удаленных строк
+	tabsMu  sync.Mutex
+	tabs    map[string]int64
+	headers map[string]bool
+	greyed  map[string]bool
+
+	indexMu    sync.Mutex
+	indexBuilt bool
 }
 
 // NewSheetsService создает новый сервис для работы с Google Sheets
-func NewSheetsService(credentialsFile string) (*SheetsService, error) {
-	// Чтение файла с учетными данными
-	b, err := os.ReadFile(credentialsFile)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+func NewSheetsService(cfg config.SheetsConfig, database *db.DB) (*SheetsService, error) {
+	if cfg.SpreadsheetID == "" {
+		return nil, errors.New("spreadsheet ID is not configured")
 	}
 
-	// Создание конфигурации из учетных данных
-	// Если учетные данные в JSON формате
-	config, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
+	// Получение HTTP-клиента с авторизацией
+	client, err := sheetsHTTPClient(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+		return nil, err
 	}
 
-	// Получение токена
-	client := getClient(config)
+	return NewSheetsServiceWithClient(cfg, database, client)
+}
 
-	// Создание сервиса Google Sheets
-	srv, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Sheets client: %v", err)
+// NewSheetsServiceWithClient создает сервис с готовым HTTP-клиентом.
+// Вместе с cfg.Endpoint позволяет работать с локальной заменой Google Sheets API.
+func NewSheetsServiceWithClient(cfg config.SheetsConfig, database *db.DB, client *http.Client) (*SheetsService, error) {
+	if cfg.SpreadsheetID == "" {
+		return nil, errors.New("spreadsheet ID is not configured")
 	}
 
-	return &SheetsService{service: srv}, nil
-}
+	s := &SheetsService{
+		db:            database,
+		spreadsheetID: cfg.SpreadsheetID,
+		sheetTemplate: cfg.SheetName,
+		tabPattern:    tabPattern(cfg.SheetName),
+		summarySheet:  cfg.SummarySheetName,
+		staffSheet:    cfg.EmployeesSheetName,
+		staffPhones:   cfg.EmployeesSheetPhones,
+		columns:       cfg.Columns,
+		headers:       make(map[string]bool),
+	}
 
-// getClient возвращает HTTP-клиент с токеном авторизации
-func getClient(config *oauth2.Config) *http.Client {
-	// Путь к токену
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+	// Проверяем, что в таблице есть все необходимые столбцы
+	for _, field := range requiredSheetFields {
+		if s.columnIndex(field) == -1 {
+			return nil, fmt.Errorf("sheet columns must include the %q field", field)
+		}
 	}
-	return config.Client(context.Background(), tok)
-}
 
-// getTokenFromWeb получает токен через веб-браузер
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
+	// Запросы считаются для метрик и журнала расхода квоты
+	counted := *client
+	counted.Transport = newQuotaTransport(client.Transport)
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+	opts := []option.ClientOption{option.WithHTTPClient(&counted)}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
 	}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+	// Создание сервиса Google Sheets
+	srv, err := sheets.NewService(context.Background(), opts...)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %w", err)
 	}
-	return tok
+	s.service = srv
+
+	return s, nil
 }
 
-// tokenFromFile загружает токен из файла
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+// Name возвращает имя приемника отчетов
+func (s *SheetsService) Name() string {
+	return "sheets"
 }
 
-// saveToken сохраняет токен в файл
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+// Report записывает событие в таблицу
+func (s *SheetsService) Report(event *ReportEvent) error {
+	switch event.Type {
+	case EventUpload, EventReassign:
+		return s.LogFileUpload(event.file(), event.user())
+	case EventDelete:
+		return s.UpdateFileStatus(event.FileID, FileStatusDeleted)
+	case EventRestore:
+		return s.UpdateFileStatus(event.FileID, FileStatusActive)
+	case EventDeleteAll:
+		return s.MarkAllFilesAsDeleted(event.UserID)
+	case EventErase:
+		return s.AnonymizeUserRows(event.UserID)
+	case EventOffboard:
+		return s.MarkUserOffboarded(event.user())
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	return fmt.Errorf("unknown event type %q", event.Type)
 }
 
 // LogFileUpload записывает информацию о загрузке файла в Google Sheets
-func (s *SheetsService) LogFileUpload(file *models.File, username string) error {
-	// Получаем текущие данные из таблицы
-	resp, err := s.service.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
-	if err != nil {
-		return fmt.Errorf("unable to retrieve data from sheet: %v", err)
+func (s *SheetsService) LogFileUpload(file *models.File, user *models.User) error {
+	// Создаем лист и строку заголовков, если их еще нет
+	tab := s.tabName(file)
+	if err := s.ensureTab(tab); err != nil {
+		return err
 	}
 
-	// Находим первую пустую строку для записи
-	nextRow := 1 // По умолчанию начинаем со строки 1 (заголовок)
+	// Создаем новую запись в порядке столбцов из конфигурации
+	valueRange := &sheets.ValueRange{
+		Values: [][]interface{}{s.rowValues(file, user, FileStatusActive)},
+	}
 
-	if len(resp.Values) > 0 {
-		// Ищем первую пустую строку
-		for i, row := range resp.Values {
-			// Проверяем, является ли строка пустой или содержит только пустые ячейки
-			isEmpty := true
-			if len(row) > 0 {
-				for _, cell := range row {
-					if cell != nil && cell != "" {
-						isEmpty = false
-						break
-					}
-				}
+	// Если файл уже записан (например, при повторной попытке), обновляем его строку
+	existing, err := s.db.GetSheetRow(file.ID)
+	if err != nil {
+		return fmt.Errorf("unable to read sheet row index: %w", err)
+	}
+	if existing != nil && existing.SheetName == tab {
+		writeRange := s.a1(tab, fmt.Sprintf("A%d:%s%d", existing.Row, s.lastColumn(), existing.Row))
+		_, err = s.service.Spreadsheets.Values.Update(s.spreadsheetID, writeRange, valueRange).
+			ValueInputOption("USER_ENTERED").
+			Do()
+		if err != nil {
+			return fmt.Errorf("unable to write data to sheet: %w", err)
+		}
+		// Файл мог перейти к другому пользователю
+		if existing.UserID != file.UserID {
+			existing.UserID = file.UserID
+			if err := s.db.SaveSheetRow(existing); err != nil {
+				log.Printf("Error saving sheet row of file %d: %v", file.ID, err)
 			}
+		}
+		return nil
+	}
 
-			if isEmpty {
-				// Нашли пустую строку
-				nextRow = i + 1 // +1 потому что индексы начинаются с 0
-				break
-			}
+	// Добавляем строку после последней заполненной строки таблицы
+	// USER_ENTERED - значения интерпретируются так, как если бы пользователь вводил их в интерфейсе
+	resp, err := s.service.Spreadsheets.Values.Append(
+		s.spreadsheetID,
+		s.a1(tab, fmt.Sprintf("A1:%s1", s.lastColumn())),
+		valueRange).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Do()
 
-			// Если дошли до конца и не нашли пустую строку
-			if i == len(resp.Values)-1 {
-				nextRow = len(resp.Values) + 1
-			}
-		}
+	if err != nil {
+		return fmt.Errorf("unable to append data to sheet: %w", err)
 	}
 
-	// Если таблица пуста, начинаем с 2 (после заголовка)
-	if nextRow == 1 && len(resp.Values) > 0 {
-		nextRow = 2
+	// Запоминаем номер строки, чтобы потом обновлять ее без поиска
+	if resp.Updates != nil {
+		if row, ok := firstRowOf(resp.Updates.UpdatedRange); ok {
+			err := s.db.SaveSheetRow(&models.SheetRow{
+				FileID:    file.ID,
+				UserID:    file.UserID,
+				SheetName: tab,
+				Row:       row,
+			})
+			if err != nil {
+				log.Printf("Error saving sheet row of file %d: %v", file.ID, err)
+			}
+		}
 	}
 
-	// Форматируем время
-	timeStr := file.CreatedAt.Format("2006-01-02 15:04:05")
+	return nil
+}
 
-	// Создаем новую запись
-	// Столбцы: ID файла, ID пользователя, Имя пользователя, Имя файла, Тип файла, Размер файла, Дата и время, Статус
-	values := []interface{}{
-		file.ID,            // ID файла
-		file.UserID,        // ID пользователя
-		username,           // Имя пользователя
-		file.FileName,      // Имя файла
-		file.FileType,      // Тип файла
-		len(file.FileData), // Размер файла в байтах
-		timeStr,            // Дата и время загрузки
-		FileStatusActive,   // Статус файла (по умолчанию активен)
+// UpdateFileStatus обновляет статус файла в Google Sheets
+func (s *SheetsService) UpdateFileStatus(fileID int64, status string) error {
+	row, err := s.findFileRow(fileID)
+	if err != nil {
+		return err
 	}
 
-	// Подготавливаем запрос на обновление
+	// Обновляем статус файла
+	writeRange := s.a1(row.SheetName, fmt.Sprintf("%s%d", s.columnLetterOf(config.SheetFieldStatus), row.Row))
 	valueRange := &sheets.ValueRange{
-		Values: [][]interface{}{values},
+		Values: [][]interface{}{{status}},
 	}
 
-	// Определяем диапазон для записи (строка целиком)
-	writeRange := fmt.Sprintf("Лист1!A%d:H%d", nextRow, nextRow)
-
-	// Записываем данные в таблицу
-	// Используем метод Update для обновления существующих данных
-	// Параметр ValueInputOption указывает, как интерпретировать входные данные
-	// USER_ENTERED - как если бы пользователь вводил их в интерфейсе
 	_, err = s.service.Spreadsheets.Values.Update(
-		spreadsheetID,
+		s.spreadsheetID,
 		writeRange,
 		valueRange).
 		ValueInputOption("USER_ENTERED").
 		Do()
 
 	if err != nil {
-		return fmt.Errorf("unable to write data to sheet: %v", err)
+		return fmt.Errorf("unable to update file status: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateFileStatus обновляет статус файла в Google Sheets
-func (s *SheetsService) UpdateFileStatus(fileID int64, status string) error {
-	// Получаем текущие данные из таблицы
-	resp, err := s.service.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+// MarkAllFilesAsDeleted отмечает все файлы пользователя как удаленные
+func (s *SheetsService) MarkAllFilesAsDeleted(userID int64) error {
+	rows, err := s.findUserRows(userID)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve data from sheet: %v", err)
-	}
-
-	// Ищем строку с нужным ID файла
-	rowIndex := -1
-	for i, row := range resp.Values {
-		if len(row) > 0 {
-			// Проверяем, что первый столбец содержит ID файла
-			if id, ok := row[0].(float64); ok && int64(id) == fileID {
-				rowIndex = i + 1 // +1 потому что строки в Sheets начинаются с 1
-				break
-			} else if id, ok := row[0].(string); ok {
-				// Пытаемся преобразовать строку в число
-				var numID int64
-				_, err := fmt.Sscanf(id, "%d", &numID)
-				if err == nil && numID == fileID {
-					rowIndex = i + 1
-					break
-				}
-			}
-		}
+		return err
 	}
 
-	if rowIndex == -1 {
-		return fmt.Errorf("file with ID %d not found in sheet", fileID)
+	// Если нет файлов для обновления, выходим
+	if len(rows) == 0 {
+		return nil
 	}
 
-	// Обновляем статус файла (столбец H)
-	writeRange := fmt.Sprintf("Лист1!H%d", rowIndex)
-	valueRange := &sheets.ValueRange{
-		Values: [][]interface{}{{status}},
+	// Собираем все строки, которые нужно обновить
+	statusColumn := s.columnLetterOf(config.SheetFieldStatus)
+	updates := make([]*sheets.ValueRange, 0, len(rows))
+	for _, row := range rows {
+		updates = append(updates, &sheets.ValueRange{
+			Range:  s.a1(row.SheetName, fmt.Sprintf("%s%d", statusColumn, row.Row)),
+			Values: [][]interface{}{{FileStatusDeleted}},
+		})
 	}
 
-	_, err = s.service.Spreadsheets.Values.Update(
-		spreadsheetID,
-		writeRange,
-		valueRange).
-		ValueInputOption("USER_ENTERED").
-		Do()
+	// Выполняем пакетное обновление
+	batchUpdateRequest := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             updates,
+	}
+
+	_, err = s.service.Spreadsheets.Values.BatchUpdate(
+		s.spreadsheetID,
+		batchUpdateRequest).Do()
 
 	if err != nil {
-		return fmt.Errorf("unable to update file status: %v", err)
+		return fmt.Errorf("unable to batch update file statuses: %w", err)
 	}
 
 	return nil
 }
 
-// MarkAllFilesAsDeleted отмечает все файлы пользователя как удаленные
-func (s *SheetsService) MarkAllFilesAsDeleted(userID int64) error {
-	// Получаем текущие данные из таблицы
-	resp, err := s.service.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+// offboardedMark добавляется к имени уволенного пользователя в строках его файлов
+const offboardedMark = " (уволен)"
+
+// sheetUserName возвращает имя пользователя, как оно записывается в таблицу
+func sheetUserName(user *models.User) string {
+	if user.Offboarded {
+		return displayName(user) + offboardedMark
+	}
+	return displayName(user)
+}
+
+// offboardedCell возвращает обновление, отмечающее уволенного пользователя в строке файла,
+// или nil, если в таблице нет столбца с именем пользователя
+func (s *SheetsService) offboardedCell(row *models.SheetRow, user *models.User) *sheets.ValueRange {
+	if s.columnIndex(config.SheetFieldUsername) == -1 {
+		return nil
+	}
+	file := &models.File{ID: row.FileID, UserID: row.UserID}
+	return s.cellUpdate(config.SheetFieldUsername, row.SheetName, row.Row, s.cellValue(config.SheetFieldUsername, file, user, ""))
+}
+
+// MarkUserOffboarded отмечает уволенного пользователя в строках файлов, которые остались за ним.
+// Переданные другому владельцу файлы переписываются событиями передачи.
+func (s *SheetsService) MarkUserOffboarded(user *models.User) error {
+	if s.columnIndex(config.SheetFieldUsername) == -1 {
+		return nil
+	}
+	rows, err := s.findUserRows(user.ID)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve data from sheet: %v", err)
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
 	}
 
-	// Собираем все строки, которые нужно обновить
-	var updates []*sheets.ValueRange
+	updates := make([]*sheets.ValueRange, 0, len(rows))
+	for _, row := range rows {
+		updates = append(updates, s.offboardedCell(row, user))
+	}
+	_, err = s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             updates,
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to mark offboarded user rows: %w", err)
+	}
+	return nil
+}
 
-	for i, row := range resp.Values {
-		if len(row) > 1 { // Проверяем, что есть хотя бы два столбца (ID файла и ID пользователя)
-			// Проверяем, что второй столбец содержит ID пользователя
-			if id, ok := row[1].(float64); ok && int64(id) == userID {
-				// Обновляем статус файла (столбец H)
-				writeRange := fmt.Sprintf("Лист1!H%d", i+1) // +1 потому что строки в Sheets начинаются с 1
-				valueRange := &sheets.ValueRange{
-					Range:  writeRange,
-					Values: [][]interface{}{{FileStatusDeleted}},
-				}
-				updates = append(updates, valueRange)
-			} else if id, ok := row[1].(string); ok {
-				// Пытаемся преобразовать строку в число
-				var numID int64
-				_, err := fmt.Sscanf(id, "%d", &numID)
-				if err == nil && numID == userID {
-					writeRange := fmt.Sprintf("Лист1!H%d", i+1)
-					valueRange := &sheets.ValueRange{
-						Range:  writeRange,
-						Values: [][]interface{}{{FileStatusDeleted}},
-					}
-					updates = append(updates, valueRange)
-				}
-			}
+// Поля с персональными данными, которые стираются при удалении данных пользователя
+var personalFields = []string{
+	config.SheetFieldUsername,
+	config.SheetFieldFirstName,
+	config.SheetFieldLastName,
+	config.SheetFieldPhone,
+	config.SheetFieldPosition,
+	config.SheetFieldEmployeeID,
+	config.SheetFieldEmail,
+	config.SheetFieldHireDate,
+}
+
+// anonymizedUsername заменяет имя пользователя, чьи данные удалены
+const anonymizedUsername = "Данные удалены"
+
+// anonymizedCells возвращает обновления, стирающие персональные данные в строке файла
+func (s *SheetsService) anonymizedCells(row *models.SheetRow) []*sheets.ValueRange {
+	var updates []*sheets.ValueRange
+	for _, field := range personalFields {
+		if s.columnIndex(field) == -1 {
+			continue
 		}
+		value := ""
+		if field == config.SheetFieldUsername {
+			value = anonymizedUsername
+		}
+		updates = append(updates, s.cellUpdate(field, row.SheetName, row.Row, value))
 	}
+	return updates
+}
 
-	// Если нет файлов для обновления, выходим
-	if len(updates) == 0 {
+// AnonymizeUserRows стирает персональные данные пользователя во всех строках его файлов
+// и отмечает файлы удаленными
+func (s *SheetsService) AnonymizeUserRows(userID int64) error {
+	rows, err := s.findUserRows(userID)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
 		return nil
 	}
 
-	// Выполняем пакетное обновление
-	batchUpdateRequest := &sheets.BatchUpdateValuesRequest{
+	var updates []*sheets.ValueRange
+	for _, row := range rows {
+		updates = append(updates, s.cellUpdate(config.SheetFieldStatus, row.SheetName, row.Row, FileStatusDeleted))
+		updates = append(updates, s.anonymizedCells(row)...)
+	}
+
+	_, err = s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
 		ValueInputOption: "USER_ENTERED",
 		Data:             updates,
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to anonymize user rows: %w", err)
 	}
+	return nil
+}
 
-	_, err = s.service.Spreadsheets.Values.BatchUpdate(
-		spreadsheetID,
-		batchUpdateRequest).Do()
+// findFileRow возвращает лист и номер строки файла.
+// Сначала используется индекс в SQLite; если строка сдвинулась или не найдена, таблица переиндексируется.
+func (s *SheetsService) findFileRow(fileID int64) (*models.SheetRow, error) {
+	if err := s.ensureIndex(); err != nil {
+		return nil, err
+	}
 
+	row, err := s.db.GetSheetRow(fileID)
 	if err != nil {
-		return fmt.Errorf("unable to batch update file statuses: %v", err)
+		return nil, fmt.Errorf("unable to read sheet row index: %w", err)
+	}
+	if row != nil && s.ownsTab(row.SheetName) {
+		ok, err := s.verifyRows([]*models.SheetRow{row})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return row, nil
+		}
 	}
 
+	// Индекс устарел: перечитываем таблицу
+	if err := s.reindex(); err != nil {
+		return nil, err
+	}
+	row, err = s.db.GetSheetRow(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sheet row index: %w", err)
+	}
+	if row == nil || !s.ownsTab(row.SheetName) {
+		return nil, fmt.Errorf("file with ID %d not found in sheet", fileID)
+	}
+	return row, nil
+}
+
+// findUserRows возвращает строки всех файлов пользователя
+func (s *SheetsService) findUserRows(userID int64) ([]*models.SheetRow, error) {
+	if err := s.ensureIndex(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.GetUserSheetRows(userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sheet row index: %w", err)
+	}
+	rows = s.ownRows(rows)
+
+	ok, err := s.verifyRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return rows, nil
+	}
+
+	// Индекс устарел: перечитываем таблицу
+	if err := s.reindex(); err != nil {
+		return nil, err
+	}
+	rows, err = s.db.GetUserSheetRows(userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sheet row index: %w", err)
+	}
+	return s.ownRows(rows), nil
+}
+
+// ownRows оставляет только строки листов, подходящих под шаблон
+func (s *SheetsService) ownRows(rows []*models.SheetRow) []*models.SheetRow {
+	var result []*models.SheetRow
+	for _, row := range rows {
+		if s.ownsTab(row.SheetName) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// verifyRows проверяет, что в строках из индекса по-прежнему находятся те же файлы
+func (s *SheetsService) verifyRows(rows []*models.SheetRow) (bool, error) {
+	if len(rows) == 0 {
+		return true, nil
+	}
+
+	idColumn := s.columnLetterOf(config.SheetFieldFileID)
+	ranges := make([]string, len(rows))
+	for i, row := range rows {
+		ranges[i] = s.a1(row.SheetName, fmt.Sprintf("%s%d", idColumn, row.Row))
+	}
+
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).Ranges(ranges...).Do()
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve data from sheet: %w", err)
+	}
+
+	if len(resp.ValueRanges) != len(rows) {
+		return false, nil
+	}
+	for i, valueRange := range resp.ValueRanges {
+		if len(valueRange.Values) == 0 || len(valueRange.Values[0]) == 0 {
+			return false, nil
+		}
+		if id, ok := cellInt64(valueRange.Values[0][0]); !ok || id != rows[i].FileID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ensureIndex один раз за время работы перестраивает индекс строк,
+// чтобы в него попали строки, записанные до появления индекса или вручную
+func (s *SheetsService) ensureIndex() error {
+	s.indexMu.Lock()
+	built := s.indexBuilt
+	s.indexMu.Unlock()
+
+	if built {
+		return nil
+	}
+	return s.reindex()
+}
+
+// reindex читает листы постранично и заново строит индекс строк в SQLite
+func (s *SheetsService) reindex() error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	tabs, err := s.ownTabs()
+	if err != nil {
+		return err
+	}
+
+	for _, tab := range tabs {
+		if err := s.reindexTab(tab); err != nil {
+			return err
+		}
+	}
+
+	// Строки удаленных листов больше не действительны
+	if err := s.db.PruneSheetRows(tabs); err != nil {
+		return fmt.Errorf("unable to save sheet row index: %w", err)
+	}
+
+	s.indexBuilt = true
+	return nil
+}
+
+// reindexTab перестраивает индекс строк одного листа
+func (s *SheetsService) reindexTab(tab string) error {
+	idColumn := s.columnIndex(config.SheetFieldFileID)
+	userColumn := s.columnIndex(config.SheetFieldUserID)
+	statusColumn := s.columnIndex(config.SheetFieldStatus)
+
+	var rows []*models.SheetRow
+	err := s.scanRows(tab, func(rowNumber int, row []interface{}) {
+		if len(row) <= idColumn || len(row) <= userColumn {
+			return
+		}
+		// Строки, отмеченные сверкой как дубликаты, не обновляются
+		if cellString(row, statusColumn) == FileStatusDuplicate {
+			return
+		}
+		fileID, ok := cellInt64(row[idColumn])
+		if !ok {
+			return
+		}
+		userID, _ := cellInt64(row[userColumn])
+		rows = append(rows, &models.SheetRow{
+			FileID:    fileID,
+			UserID:    userID,
+			SheetName: tab,
+			Row:       rowNumber,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.ReplaceSheetRows(tab, rows); err != nil {
+		return fmt.Errorf("unable to save sheet row index: %w", err)
+	}
+
+	log.Printf("Sheet %q indexed: %d rows", tab, len(rows))
+	return nil
+}
+
+// scanAllRows читает строки данных всех листов, подходящих под шаблон
+func (s *SheetsService) scanAllRows(fn func(tab string, rowNumber int, row []interface{})) error {
+	tabs, err := s.ownTabs()
+	if err != nil {
+		return err
+	}
+
+	for _, tab := range tabs {
+		err := s.scanRows(tab, func(rowNumber int, row []interface{}) {
+			fn(tab, rowNumber, row)
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// scanRows читает все строки данных листа страницами по sheetPageSize строк.
+// Чтение заканчивается на первой полностью пустой странице.
+func (s *SheetsService) scanRows(tab string, fn func(rowNumber int, row []interface{})) error {
+	for start := 2; ; start += sheetPageSize {
+		end := start + sheetPageSize - 1
+		pageRange := s.a1(tab, fmt.Sprintf("A%d:%s%d", start, s.lastColumn(), end))
+
+		// Числа читаются без форматирования, чтобы их можно было сравнивать
+		resp, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, pageRange).
+			ValueRenderOption("UNFORMATTED_VALUE").
+			Do()
+		if err != nil {
+			return fmt.Errorf("unable to retrieve data from sheet: %w", err)
+		}
+		if len(resp.Values) == 0 {
+			return nil
+		}
+
+		for i, row := range resp.Values {
+			fn(start+i, row)
+		}
+	}
+}
+
+// rowValues формирует значения строки в порядке столбцов из конфигурации
+func (s *SheetsService) rowValues(file *models.File, user *models.User, status string) []interface{} {
+	values := make([]interface{}, len(s.columns))
+	for i, column := range s.columns {
+		values[i] = s.cellValue(column.Field, file, user, status)
+	}
+	return values
+}
+
+// cellValue возвращает содержимое ячейки поля. Имя файла и имя пользователя записываются
+// ссылками: на файл в боте и на профиль в Telegram; в таблице видно то же значение, что и в fieldValue.
+// Строки из профиля, имен и названий групп экранируются, чтобы они не выполнялись как формулы.
+func (s *SheetsService) cellValue(field string, file *models.File, user *models.User, status string) interface{} {
+	switch field {
+	case config.SheetFieldFileName:
+		if s.botUsername != "" {
+			return hyperlinkFormula(fileDeepLink(s.botUsername, file.ID), file.FileName)
+		}
+	case config.SheetFieldUsername:
+		if user != nil && user.Username != "" {
+			return hyperlinkFormula(profileLink(user.Username), sheetUserName(user))
+		}
+	}
+	return escapeCell(fieldValue(field, file, user, status))
+}
+
+// escapeCell добавляет апостроф к строке, которую USER_ENTERED прочитал бы как формулу.
+// Апостроф в ячейке не виден, поэтому при чтении значение совпадает с fieldValue.
+func escapeCell(value interface{}) interface{} {
+	if text, ok := value.(string); ok && text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+		return "'" + text
+	}
+	return value
+}
+
+// SetBotUsername задает имя бота для ссылок на файлы
+func (s *SheetsService) SetBotUsername(username string) {
+	s.botUsername = username
+}
+
+// fieldValue возвращает значение поля файла или пользователя, как оно отображается в ячейке
+func fieldValue(field string, file *models.File, user *models.User, status string) interface{} {
+	if user == nil {
+		user = &models.User{ID: file.UserID}
+	}
+
+	switch field {
+	case config.SheetFieldFileID:
+		return file.ID
+	case config.SheetFieldUserID:
+		return file.UserID
+	case config.SheetFieldUsername:
+		return sheetUserName(user)
+	case config.SheetFieldFirstName:
+		return user.FirstName
+	case config.SheetFieldLastName:
+		return user.LastName
+	case config.SheetFieldPhone:
+		return user.Phone
+	case config.SheetFieldPosition:
+		return user.Position
+	case config.SheetFieldEmployeeID:
+		return user.EmployeeID
+	case config.SheetFieldEmail:
+		return user.Email
+	case config.SheetFieldDepartment:
+		return user.Department
+	case config.SheetFieldHireDate:
+		return formatDate(user.HireDate, "2006-01-02")
+	case config.SheetFieldFileName:
+		return file.FileName
+	case config.SheetFieldFileType:
+		return file.FileType
+	case config.SheetFieldFileSize:
+		return humanSize(file.Size)
+	case config.SheetFieldCreatedAt:
+		return file.CreatedAt.Format("2006-01-02 15:04:05")
+	case config.SheetFieldTeam:
+		return file.Team
+	case config.SheetFieldStatus:
+		return status
+	case config.SheetFieldReview:
+		return reviewLabels[file.Review]
+	case config.SheetFieldReviewComment:
+		return file.ReviewComment
+	}
+	return ""
+}
+
+// displayName возвращает username пользователя, а если его нет - имя и фамилию
+func displayName(user *models.User) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", user.FirstName, user.LastName))
+}
+
+// columnIndex возвращает номер столбца (с нуля) для поля или -1, если его нет в таблице
+func (s *SheetsService) columnIndex(field string) int {
+	for i, column := range s.columns {
+		if column.Field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// columnLetterOf возвращает букву столбца для поля
+func (s *SheetsService) columnLetterOf(field string) string {
+	return columnLetter(s.columnIndex(field))
+}
+
+// lastColumn возвращает букву последнего столбца таблицы
+func (s *SheetsService) lastColumn() string {
+	return columnLetter(len(s.columns) - 1)
+}
+
+// a1 добавляет к диапазону имя листа в кавычках
+func (s *SheetsService) a1(tab, cells string) string {
+	return fmt.Sprintf("'%s'!%s", strings.ReplaceAll(tab, "'", "''"), cells)
+}
+
+// columnLetter переводит номер столбца (с нуля) в буквенное обозначение: 0 -> A, 26 -> AA
+func columnLetter(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
+
+// cellInt64 читает целое число из ячейки, которая может прийти как число или как строка
+func cellInt64(cell interface{}) (int64, bool) {
+	switch v := cell.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		var id int64
+		if _, err := fmt.Sscanf(v, "%d", &id); err != nil {
+			return 0, false
+		}
+		return id, true
+	}
+	return 0, false
+}
+
+// firstRowOf возвращает номер первой строки диапазона вида 'Лист1'!A5:H5
+func firstRowOf(a1Range string) (int, bool) {
+	cells := a1Range[strings.LastIndex(a1Range, "!")+1:]
+	cells = strings.SplitN(cells, ":", 2)[0]
+	digits := strings.TrimLeft(cells, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	row, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, false
+	}
+	return row, true
+}
@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"telegram-bot/config"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Время ожидания ответа от браузера при авторизации
+const authTimeout = 5 * time.Minute
+
+// sheetsHTTPClient возвращает HTTP-клиент с авторизацией для Google Sheets API
+func sheetsHTTPClient(cfg config.SheetsConfig) (*http.Client, error) {
+	// Чтение файла с учетными данными
+	b, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials file: %v", err)
+	}
+
+	switch cfg.Auth {
+	case config.SheetsAuthServiceAccount:
+		// Сервисный аккаунт не требует участия пользователя
+		jwtConfig, err := google.JWTConfigFromJSON(b, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account key: %v", err)
+		}
+		return jwtConfig.Client(context.Background()), nil
+
+	case config.SheetsAuthOAuth:
+		oauthConfig, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+		}
+
+		tok, err := tokenFromFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read OAuth token from %s, run the auth command first: %v", cfg.TokenFile, err)
+		}
+
+		// Обновленный токен сохраняется обратно в файл
+		ts := &savingTokenSource{
+			base: oauthConfig.TokenSource(context.Background(), tok),
+			path: cfg.TokenFile,
+			last: tok,
+		}
+		return oauth2.NewClient(context.Background(), ts), nil
+	}
+
+	return nil, fmt.Errorf("unknown Google Sheets auth mode %q", cfg.Auth)
+}
+
+// savingTokenSource записывает токен на диск каждый раз, когда он обновляется
+type savingTokenSource struct {
+	base oauth2.TokenSource
+	path string
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last == nil || tok.AccessToken != s.last.AccessToken || tok.RefreshToken != s.last.RefreshToken {
+		if err := saveToken(s.path, tok); err != nil {
+			// Токен остается рабочим, просто не переживет перезапуск
+			fmt.Fprintf(os.Stderr, "Unable to save refreshed OAuth token: %v\n", err)
+		}
+		s.last = tok
+	}
+	return tok, nil
+}
+
+// RunSheetsAuth проводит OAuth-авторизацию через браузер с перенаправлением на локальный адрес
+// и сохраняет полученный токен в файл из конфигурации
+func RunSheetsAuth(cfg config.SheetsConfig) error {
+	if cfg.Auth == config.SheetsAuthServiceAccount {
+		fmt.Println("Google Sheets is configured to use a service account, no authorization is needed.")
+		return nil
+	}
+
+	b, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("unable to read credentials file: %v", err)
+	}
+	oauthConfig, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
+	if err != nil {
+		return fmt.Errorf("unable to parse client secret file to config: %v", err)
+	}
+
+	// Слушаем случайный порт на локальном интерфейсе
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("unable to start local listener: %v", err)
+	}
+	defer listener.Close()
+	oauthConfig.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr().String())
+
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+
+	type authResult struct {
+		code string
+		err  error
+	}
+	results := make(chan authResult, 1)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("state") != state {
+				http.Error(w, "Invalid state", http.StatusBadRequest)
+				return
+			}
+			if errText := query.Get("error"); errText != "" {
+				fmt.Fprintln(w, "Авторизация отклонена. Окно можно закрыть.")
+				results <- authResult{err: fmt.Errorf("authorization denied: %s", errText)}
+				return
+			}
+			fmt.Fprintln(w, "Авторизация завершена. Окно можно закрыть.")
+			results <- authResult{code: query.Get("code")}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	fmt.Printf("Open the following link in your browser to authorize access to Google Sheets:\n%s\n", authURL)
+
+	var result authResult
+	select {
+	case result = <-results:
+	case <-time.After(authTimeout):
+		return errors.New("timed out waiting for authorization")
+	}
+	if result.err != nil {
+		return result.err
+	}
+
+	tok, err := oauthConfig.Exchange(context.Background(), result.code)
+	if err != nil {
+		return fmt.Errorf("unable to exchange authorization code: %v", err)
+	}
+
+	if err := saveToken(cfg.TokenFile, tok); err != nil {
+		return err
+	}
+	fmt.Printf("Token saved to %s\n", cfg.TokenFile)
+	return nil
+}
+
+// randomState создает случайное значение параметра state для защиты от CSRF
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate state: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// tokenFromFile загружает токен из файла
+func tokenFromFile(file string) (*oauth2.Token, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tok := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(tok)
+	return tok, err
+}
+
+// saveToken сохраняет токен в файл. Файл записывается целиком через временный файл.
+func saveToken(path string, token *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create token directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return fmt.Errorf("unable to cache oauth token: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(token); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to cache oauth token: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %v", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
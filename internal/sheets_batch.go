@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"telegram-bot/config"
+	"telegram-bot/models"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// ReportBatch записывает несколько событий за минимальное число запросов:
+// новые строки добавляются одним запросом на лист, а перезапись строк и статусы -
+// одним BatchUpdate. Файлы, которых нет в таблице, пропускаются до следующей сверки.
+func (s *SheetsService) ReportBatch(events []*ReportEvent) error {
+	var uploads, statusEvents []*ReportEvent
+	offboarded := make(map[int64]*models.User)
+	var fileIDs, userIDs []int64
+
+	for _, event := range events {
+		switch event.Type {
+		case EventUpload, EventReassign:
+			uploads = append(uploads, event)
+		case EventDelete, EventRestore:
+			statusEvents = append(statusEvents, event)
+			fileIDs = append(fileIDs, event.FileID)
+		case EventDeleteAll, EventErase:
+			statusEvents = append(statusEvents, event)
+			userIDs = append(userIDs, event.UserID)
+		case EventOffboard:
+			statusEvents = append(statusEvents, event)
+			userIDs = append(userIDs, event.UserID)
+			offboarded[event.UserID] = event.user()
+		default:
+			return fmt.Errorf("unknown event type %q", event.Type)
+		}
+	}
+
+	// Загрузки: уже записанные строки перезаписываются, остальные добавляются в конец листов
+	var updates []*sheets.ValueRange
+	var reowned []*models.SheetRow
+	appends := make(map[string][]*ReportEvent)
+	uploaded := make(map[int64]bool)
+	for _, event := range uploads {
+		uploaded[event.FileID] = true
+		file := event.file()
+		tab := s.tabName(file)
+		if err := s.ensureTab(tab); err != nil {
+			return err
+		}
+
+		existing, err := s.db.GetSheetRow(file.ID)
+		if err != nil {
+			return fmt.Errorf("unable to read sheet row index: %w", err)
+		}
+		if existing != nil && existing.SheetName == tab {
+			updates = append(updates, &sheets.ValueRange{
+				Range:  s.a1(tab, fmt.Sprintf("A%d:%s%d", existing.Row, s.lastColumn(), existing.Row)),
+				Values: [][]interface{}{s.rowValues(file, event.user(), FileStatusActive)},
+			})
+			// Файл перешел к другому пользователю: индекс обновляется после записи
+			if existing.UserID != file.UserID {
+				existing.UserID = file.UserID
+				reowned = append(reowned, existing)
+			}
+			continue
+		}
+		appends[tab] = append(appends[tab], event)
+	}
+
+	tabs := make([]string, 0, len(appends))
+	for tab := range appends {
+		tabs = append(tabs, tab)
+	}
+	sort.Strings(tabs)
+	for _, tab := range tabs {
+		if err := s.appendRows(tab, appends[tab]); err != nil {
+			return err
+		}
+	}
+
+	// Статусы применяются в порядке событий, в ячейку попадает последний
+	if len(statusEvents) > 0 {
+		rows, err := s.lookupRows(fileIDs, userIDs)
+		if err != nil {
+			return err
+		}
+
+		statuses := make(map[*models.SheetRow]string)
+		var order []*models.SheetRow
+		setStatus := func(row *models.SheetRow, status string) {
+			if _, ok := statuses[row]; !ok {
+				order = append(order, row)
+			}
+			statuses[row] = status
+		}
+
+		for _, event := range statusEvents {
+			switch event.Type {
+			case EventDeleteAll:
+				for _, row := range rows.byUser[event.UserID] {
+					setStatus(rows.canonical(row), FileStatusDeleted)
+				}
+			case EventErase:
+				for _, row := range rows.byUser[event.UserID] {
+					setStatus(rows.canonical(row), FileStatusDeleted)
+					updates = append(updates, s.anonymizedCells(row)...)
+				}
+			case EventOffboard:
+				// Статус файлов не меняется, отмечается только имя. Строки, переписанные
+				// в этом же пакете, индекс еще относит к прежнему владельцу
+				for _, row := range rows.byUser[event.UserID] {
+					if uploaded[row.FileID] {
+						continue
+					}
+					if update := s.offboardedCell(row, offboarded[event.UserID]); update != nil {
+						updates = append(updates, update)
+					}
+				}
+			case EventDelete, EventRestore:
+				row := rows.byFile[event.FileID]
+				if row == nil {
+					log.Printf("File %d not found in Google Sheets, left for reconciliation", event.FileID)
+					continue
+				}
+				status := FileStatusDeleted
+				if event.Type == EventRestore {
+					status = FileStatusActive
+				}
+				setStatus(rows.canonical(row), status)
+			}
+		}
+
+		statusColumn := s.columnLetterOf(config.SheetFieldStatus)
+		for _, row := range order {
+			updates = append(updates, &sheets.ValueRange{
+				Range:  s.a1(row.SheetName, fmt.Sprintf("%s%d", statusColumn, row.Row)),
+				Values: [][]interface{}{{statuses[row]}},
+			})
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	_, err := s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             updates,
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to batch update sheet: %w", err)
+	}
+
+	for _, row := range reowned {
+		if err := s.db.SaveSheetRow(row); err != nil {
+			log.Printf("Error saving sheet row of file %d: %v", row.FileID, err)
+		}
+	}
+	return nil
+}
+
+// appendRows добавляет строки загрузок в конец листа одним запросом и запоминает их номера
+func (s *SheetsService) appendRows(tab string, events []*ReportEvent) error {
+	values := make([][]interface{}, len(events))
+	for i, event := range events {
+		values[i] = s.rowValues(event.file(), event.user(), FileStatusActive)
+	}
+
+	resp, err := s.service.Spreadsheets.Values.Append(
+		s.spreadsheetID,
+		s.a1(tab, fmt.Sprintf("A1:%s1", s.lastColumn())),
+		&sheets.ValueRange{Values: values}).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to append data to sheet: %w", err)
+	}
+
+	if resp.Updates == nil {
+		return nil
+	}
+	first, ok := firstRowOf(resp.Updates.UpdatedRange)
+	if !ok {
+		return nil
+	}
+	for i, event := range events {
+		err := s.db.SaveSheetRow(&models.SheetRow{
+			FileID:    event.FileID,
+			UserID:    event.UserID,
+			SheetName: tab,
+			Row:       first + i,
+		})
+		if err != nil {
+			log.Printf("Error saving sheet row of file %d: %v", event.FileID, err)
+		}
+	}
+	return nil
+}
+
+// sheetRowSet - найденные строки файлов и пользователей
+type sheetRowSet struct {
+	byFile map[int64]*models.SheetRow
+	byUser map[int64][]*models.SheetRow
+}
+
+// canonical возвращает одну и ту же запись для строки файла, найденной по файлу и по пользователю
+func (set *sheetRowSet) canonical(row *models.SheetRow) *models.SheetRow {
+	if known, ok := set.byFile[row.FileID]; ok {
+		return known
+	}
+	set.byFile[row.FileID] = row
+	return row
+}
+
+// lookupRows находит строки файлов и всех файлов пользователей.
+// Строки из индекса проверяются одним запросом; если индекс устарел, таблица переиндексируется.
+func (s *SheetsService) lookupRows(fileIDs, userIDs []int64) (*sheetRowSet, error) {
+	if err := s.ensureIndex(); err != nil {
+		return nil, err
+	}
+
+	// collect собирает строки из индекса и сообщает, нашлись ли все файлы
+	collect := func() (*sheetRowSet, []*models.SheetRow, bool, error) {
+		set := &sheetRowSet{
+			byFile: make(map[int64]*models.SheetRow),
+			byUser: make(map[int64][]*models.SheetRow),
+		}
+		var all []*models.SheetRow
+		found := true
+		for _, fileID := range fileIDs {
+			if _, ok := set.byFile[fileID]; ok {
+				continue
+			}
+			row, err := s.db.GetSheetRow(fileID)
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("unable to read sheet row index: %w", err)
+			}
+			if row == nil || !s.ownsTab(row.SheetName) {
+				found = false
+				continue
+			}
+			set.byFile[fileID] = row
+			all = append(all, row)
+		}
+		for _, userID := range userIDs {
+			rows, err := s.db.GetUserSheetRows(userID)
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("unable to read sheet row index: %w", err)
+			}
+			set.byUser[userID] = s.ownRows(rows)
+			all = append(all, set.byUser[userID]...)
+		}
+		return set, all, found, nil
+	}
+
+	set, all, found, err := collect()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.verifyRows(all)
+	if err != nil {
+		return nil, err
+	}
+	if ok && found {
+		return set, nil
+	}
+
+	// Индекс устарел или в нем нет части файлов: перечитываем таблицу
+	if err := s.reindex(); err != nil {
+		return nil, err
+	}
+	set, _, _, err = collect()
+	return set, err
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"telegram-bot/models"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Статусы сотрудников на листе сотрудников
+const (
+	employeeStatusActive     = "Работает"
+	employeeStatusOffboarded = "Уволен"
+	employeeStatusBanned     = "Заблокирован"
+	employeeStatusPending    = "Ожидает подтверждения"
+)
+
+// employeeStatus возвращает статус пользователя для листа сотрудников
+func employeeStatus(user *models.User) string {
+	switch {
+	case user.Offboarded:
+		return employeeStatusOffboarded
+	case user.Banned:
+		return employeeStatusBanned
+	case !user.Approved:
+		return employeeStatusPending
+	default:
+		return employeeStatusActive
+	}
+}
+
+// UpdateEmployees перезаписывает лист сотрудников: по строке на каждого пользователя с профилем и статусом.
+// Телефоны записываются, только если это включено в конфигурации.
+func (s *SheetsService) UpdateEmployees(users []*models.User) error {
+	if s.staffSheet == "" {
+		return nil
+	}
+
+	header := []interface{}{"ID пользователя", "Username", "Имя", "Фамилия"}
+	if s.staffPhones {
+		header = append(header, "Телефон")
+	}
+	header = append(header, "Отдел", "Должность", "Табельный номер", "Email", "Дата приема",
+		"Зарегистрирован", "Последняя активность", "Статус")
+
+	values := [][]interface{}{header}
+	for _, user := range users {
+		row := []interface{}{user.ID, user.Username, user.FirstName, user.LastName}
+		if s.staffPhones {
+			row = append(row, user.Phone)
+		}
+		row = append(row, user.Department, user.Position, user.EmployeeID, user.Email, formatDate(user.HireDate, "2006-01-02"),
+			formatDate(user.CreatedAt.Local(), "2006-01-02 15:04:05"), formatDate(user.LastSeen.Local(), "2006-01-02 15:04:05"),
+			employeeStatus(user))
+		values = append(values, row)
+	}
+
+	if err := s.ensureStaticTab(s.staffSheet, len(header)); err != nil {
+		return err
+	}
+
+	// Лист перезаписывается целиком, как и сводка
+	_, err := s.service.Spreadsheets.Values.Clear(s.spreadsheetID, s.a1(s.staffSheet, "A:ZZ"),
+		&sheets.ClearValuesRequest{}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to clear employees sheet: %w", err)
+	}
+
+	_, err = s.service.Spreadsheets.Values.Update(s.spreadsheetID, s.a1(s.staffSheet, "A1"),
+		&sheets.ValueRange{Values: values}).
+		ValueInputOption("RAW").
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to write employees sheet: %w", err)
+	}
+	return nil
+}
+
+// formatDate форматирует дату для таблицы; пустая дата дает пустую ячейку
+func formatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// refreshEmployees обновляет лист сотрудников по таблице пользователей
+func (b *Bot) refreshEmployees() {
+	if b.SheetsService == nil || b.SheetsService.staffSheet == "" {
+		return
+	}
+
+	users, err := b.DB.GetAllUsers()
+	if err != nil {
+		log.Printf("Error getting users for the employees sheet: %v", err)
+		return
+	}
+	if err := b.SheetsService.UpdateEmployees(users); err != nil {
+		log.Printf("Error updating Google Sheets employees sheet: %v", err)
+	}
+}
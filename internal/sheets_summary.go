@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"telegram-bot/db"
+	"telegram-bot/models"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// UpdateSummary перезаписывает сводный лист: количество файлов каждого пользователя по месяцам
+func (s *SheetsService) UpdateSummary(files []*models.File, users map[int64]*models.User) error {
+	if s.summarySheet == "" {
+		return nil
+	}
+
+	// Считаем файлы по пользователям и месяцам
+	counts := make(map[int64]map[string]int)
+	monthSet := make(map[string]bool)
+	for _, file := range files {
+		month := file.CreatedAt.Format("2006-01")
+		monthSet[month] = true
+		if counts[file.UserID] == nil {
+			counts[file.UserID] = make(map[string]int)
+		}
+		counts[file.UserID][month]++
+	}
+
+	months := make([]string, 0, len(monthSet))
+	for month := range monthSet {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	names := make(map[int64]string, len(counts))
+	userIDs := make([]int64, 0, len(counts))
+	for userID := range counts {
+		user := users[userID]
+		if user == nil {
+			user = &models.User{ID: userID}
+		}
+		names[userID] = displayName(user)
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := strings.ToLower(names[userIDs[i]]), strings.ToLower(names[userIDs[j]])
+		if a != b {
+			return a < b
+		}
+		return userIDs[i] < userIDs[j]
+	})
+
+	// Заголовок, строка на каждого пользователя и итоговая строка
+	header := []interface{}{"Сотрудник", "ID пользователя"}
+	for _, month := range months {
+		header = append(header, month)
+	}
+	header = append(header, "Всего")
+	values := [][]interface{}{header}
+
+	totals := make([]int, len(months))
+	for _, userID := range userIDs {
+		row := []interface{}{names[userID], userID}
+		sum := 0
+		for i, month := range months {
+			n := counts[userID][month]
+			row = append(row, n)
+			totals[i] += n
+			sum += n
+		}
+		values = append(values, append(row, sum))
+	}
+
+	totalRow := []interface{}{"Итого", ""}
+	for _, n := range totals {
+		totalRow = append(totalRow, n)
+	}
+	values = append(values, append(totalRow, len(files)))
+
+	if err := s.ensureStaticTab(s.summarySheet, len(header)); err != nil {
+		return err
+	}
+
+	// Старые данные удаляются целиком: число месяцев и пользователей могло измениться
+	_, err := s.service.Spreadsheets.Values.Clear(s.spreadsheetID, s.a1(s.summarySheet, "A:ZZ"),
+		&sheets.ClearValuesRequest{}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to clear summary sheet: %w", err)
+	}
+
+	_, err = s.service.Spreadsheets.Values.Update(s.spreadsheetID, s.a1(s.summarySheet, "A1"),
+		&sheets.ValueRange{Values: values}).
+		ValueInputOption("RAW").
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to write summary sheet: %w", err)
+	}
+	return nil
+}
+
+// ensureStaticTab создает служебный лист (сводку или список сотрудников), если его еще нет
+func (s *SheetsService) ensureStaticTab(tab string, columns int) error {
+	s.tabsMu.Lock()
+	defer s.tabsMu.Unlock()
+
+	if _, ok := s.tabs[tab]; ok {
+		return nil
+	}
+	if err := s.loadTabs(); err != nil {
+		return err
+	}
+	if _, ok := s.tabs[tab]; ok {
+		return nil
+	}
+	return s.addTab(tab, columns)
+}
+
+// updateSummary обновляет сводный лист по текущему содержимому баз данных
+func updateSummary(s *SheetsService, database *db.DB) error {
+	files, err := database.GetAllFilesInfo()
+	if err != nil {
+		return fmt.Errorf("unable to get files: %w", err)
+	}
+
+	userList, err := database.GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("unable to get users: %w", err)
+	}
+	users := make(map[int64]*models.User, len(userList))
+	for _, user := range userList {
+		users[user.ID] = user
+	}
+
+	return s.UpdateSummary(files, users)
+}
+
+// runSummaryJob обновляет сводный лист и список сотрудников при запуске и затем периодически
+func (b *Bot) runSummaryJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := updateSummary(b.SheetsService, b.DB); err != nil {
+			log.Printf("Error updating Google Sheets summary: %v", err)
+		}
+		b.refreshEmployees()
+		<-ticker.C
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"telegram-bot/config"
+	"telegram-bot/models"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Подстановки в шаблоне имени листа
+const (
+	tabPlaceholderYear  = "{year}"
+	tabPlaceholderMonth = "{month}"
+	tabPlaceholderTeam  = "{team}"
+
+	// Значение {team} для файлов без команды
+	tabNoTeam = "Без команды"
+)
+
+// tabPattern строит регулярное выражение, которому соответствуют имена листов, созданных по шаблону
+func tabPattern(template string) *regexp.Regexp {
+	pattern := strings.NewReplacer(
+		regexp.QuoteMeta(tabPlaceholderYear), `\d{4}`,
+		regexp.QuoteMeta(tabPlaceholderMonth), `\d{4}-\d{2}`,
+		regexp.QuoteMeta(tabPlaceholderTeam), `.+`,
+	).Replace(regexp.QuoteMeta(template))
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// tabName возвращает имя листа для файла, например "2026-10" или "Sales/2026-10"
+func (s *SheetsService) tabName(file *models.File) string {
+	team := file.Team
+	if team == "" {
+		team = tabNoTeam
+	}
+	return strings.NewReplacer(
+		tabPlaceholderYear, file.CreatedAt.Format("2006"),
+		tabPlaceholderMonth, file.CreatedAt.Format("2006-01"),
+		tabPlaceholderTeam, team,
+	).Replace(s.sheetTemplate)
+}
+
+// ownsTab сообщает, относится ли лист к журналу загрузок
+func (s *SheetsService) ownsTab(tab string) bool {
+	return tab != s.summarySheet && tab != s.staffSheet && s.tabPattern.MatchString(tab)
+}
+
+// ownTabs перечитывает список листов и возвращает листы журнала в порядке имен
+func (s *SheetsService) ownTabs() ([]string, error) {
+	s.tabsMu.Lock()
+	defer s.tabsMu.Unlock()
+
+	if err := s.loadTabs(); err != nil {
+		return nil, err
+	}
+
+	var tabs []string
+	for tab := range s.tabs {
+		if s.ownsTab(tab) {
+			tabs = append(tabs, tab)
+		}
+	}
+	sort.Strings(tabs)
+	return tabs, nil
+}
+
+// loadTabs читает список листов таблицы. Вызывается под tabsMu.
+func (s *SheetsService) loadTabs() error {
+	resp, err := s.service.Spreadsheets.Get(s.spreadsheetID).
+		Fields("sheets(properties(sheetId,title),conditionalFormats)").
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve spreadsheet: %w", err)
+	}
+
+	s.tabs = make(map[string]int64, len(resp.Sheets))
+	s.greyed = make(map[string]bool, len(resp.Sheets))
+	formula := s.deletedRowsFormula()
+	for _, sheet := range resp.Sheets {
+		s.tabs[sheet.Properties.Title] = sheet.Properties.SheetId
+		for _, rule := range sheet.ConditionalFormats {
+			if rule.BooleanRule != nil && rule.BooleanRule.Condition != nil &&
+				len(rule.BooleanRule.Condition.Values) == 1 &&
+				rule.BooleanRule.Condition.Values[0].UserEnteredValue == formula {
+				s.greyed[sheet.Properties.Title] = true
+			}
+		}
+	}
+	return nil
+}
+
+// deletedRowsFormula - условие форматирования строк удаленных файлов
+func (s *SheetsService) deletedRowsFormula() string {
+	return fmt.Sprintf(`=$%s2="%s"`, s.columnLetterOf(config.SheetFieldStatus), FileStatusDeleted)
+}
+
+// greyOutDeletedRows добавляет на лист правило, которое выделяет серым строки удаленных файлов. Вызывается под tabsMu.
+func (s *SheetsService) greyOutDeletedRows(tab string) error {
+	grey := &sheets.Color{Red: 0.6, Green: 0.6, Blue: 0.6}
+	light := &sheets.Color{Red: 0.95, Green: 0.95, Blue: 0.95}
+
+	_, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			AddConditionalFormatRule: &sheets.AddConditionalFormatRuleRequest{
+				Rule: &sheets.ConditionalFormatRule{
+					Ranges: []*sheets.GridRange{{
+						SheetId:       s.tabs[tab],
+						StartRowIndex: 1,
+					}},
+					BooleanRule: &sheets.BooleanRule{
+						Condition: &sheets.BooleanCondition{
+							Type:   "CUSTOM_FORMULA",
+							Values: []*sheets.ConditionValue{{UserEnteredValue: s.deletedRowsFormula()}},
+						},
+						Format: &sheets.CellFormat{
+							BackgroundColor: light,
+							TextFormat:      &sheets.TextFormat{ForegroundColor: grey},
+						},
+					},
+				},
+				Index: 0,
+			},
+		}},
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to add conditional formatting to sheet %q: %w", tab, err)
+	}
+
+	s.greyed[tab] = true
+	return nil
+}
+
+// ensureTab создает лист с заголовками, если его еще нет,
+// а у существующего листа записывает заголовки в пустую первую строку
+func (s *SheetsService) ensureTab(tab string) error {
+	s.tabsMu.Lock()
+	defer s.tabsMu.Unlock()
+
+	if s.headers[tab] {
+		return nil
+	}
+
+	if _, ok := s.tabs[tab]; !ok {
+		// Лист мог появиться после последнего чтения списка
+		if err := s.loadTabs(); err != nil {
+			return err
+		}
+	}
+	if _, ok := s.tabs[tab]; !ok {
+		if err := s.addTab(tab, len(s.columns)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.ensureHeader(tab); err != nil {
+		return err
+	}
+	if !s.greyed[tab] {
+		// Оформление не обязательно для записи строк
+		if err := s.greyOutDeletedRows(tab); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	s.headers[tab] = true
+	return nil
+}
+
+// addTab создает лист с закрепленной первой строкой и полужирными заголовками. Вызывается под tabsMu.
+func (s *SheetsService) addTab(tab string, columns int) error {
+	resp, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			AddSheet: &sheets.AddSheetRequest{
+				Properties: &sheets.SheetProperties{
+					Title: tab,
+					GridProperties: &sheets.GridProperties{
+						FrozenRowCount: 1,
+					},
+				},
+			},
+		}},
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to add sheet %q: %w", tab, err)
+	}
+
+	sheetID := resp.Replies[0].AddSheet.Properties.SheetId
+	s.tabs[tab] = sheetID
+
+	_, err = s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range: &sheets.GridRange{
+					SheetId:          sheetID,
+					StartRowIndex:    0,
+					EndRowIndex:      1,
+					StartColumnIndex: 0,
+					EndColumnIndex:   int64(columns),
+				},
+				Cell: &sheets.CellData{
+					UserEnteredFormat: &sheets.CellFormat{
+						TextFormat: &sheets.TextFormat{Bold: true},
+					},
+				},
+				Fields: "userEnteredFormat.textFormat.bold",
+			},
+		}},
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to format sheet %q: %w", tab, err)
+	}
+	return nil
+}
+
+// ensureHeader записывает заголовки столбцов в первую строку листа, если она пуста
+func (s *SheetsService) ensureHeader(tab string) error {
+	headerRange := s.a1(tab, fmt.Sprintf("A1:%s1", s.lastColumn()))
+	resp, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, headerRange).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read sheet header: %w", err)
+	}
+	if len(resp.Values) > 0 && len(resp.Values[0]) > 0 {
+		return nil
+	}
+
+	header := make([]interface{}, len(s.columns))
+	for i, column := range s.columns {
+		header[i] = column.Header
+	}
+
+	_, err = s.service.Spreadsheets.Values.Update(
+		s.spreadsheetID,
+		headerRange,
+		&sheets.ValueRange{Values: [][]interface{}{header}}).
+		ValueInputOption("RAW").
+		Do()
+	if err != nil {
+		return fmt.Errorf("unable to write sheet header: %w", err)
+	}
+	return nil
+}
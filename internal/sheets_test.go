@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"net/http"
+	"path/filepath"
+	"telegram-bot/config"
+	"telegram-bot/db"
+	"telegram-bot/internal/sheetsfake"
+	"telegram-bot/models"
+	"testing"
+	"time"
+)
+
+const testSpreadsheet = "test"
+
+// Столбцы тестовой таблицы: ID файла, ID пользователя, имя файла, статус
+var testColumns = []config.SheetColumn{
+	{Header: "ID файла", Field: config.SheetFieldFileID},
+	{Header: "ID пользователя", Field: config.SheetFieldUserID},
+	{Header: "Имя файла", Field: config.SheetFieldFileName},
+	{Header: "Статус", Field: config.SheetFieldStatus},
+}
+
+// newTestDB создает временную базу. MongoDB не нужна: соединение устанавливается
+// только при первом запросе к файлам
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "bot.db"), "mongodb://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	return database
+}
+
+// newTestSheets создает сервис, работающий с локальной заменой Google Sheets и временной базой
+func newTestSheets(t *testing.T) (*SheetsService, *sheetsfake.Server, *db.DB) {
+	t.Helper()
+
+	fake := sheetsfake.NewServer()
+	t.Cleanup(fake.Close)
+	fake.AddSpreadsheet(testSpreadsheet, "Лист1")
+
+	database := newTestDB(t)
+
+	cfg := config.SheetsConfig{
+		SpreadsheetID: testSpreadsheet,
+		Endpoint:      fake.URL,
+		SheetName:     "Лист1",
+		Columns:       testColumns,
+	}
+	s, err := NewSheetsServiceWithClient(cfg, database, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewSheetsServiceWithClient: %v", err)
+	}
+	return s, fake, database
+}
+
+// writeEvents записывает события по одному или одним пакетом
+func writeEvents(t *testing.T, s *SheetsService, batch bool, events ...*ReportEvent) {
+	t.Helper()
+
+	if batch {
+		if err := s.ReportBatch(events); err != nil {
+			t.Fatalf("ReportBatch: %v", err)
+		}
+		return
+	}
+	for _, event := range events {
+		if err := s.Report(event); err != nil {
+			t.Fatalf("Report(%s %d): %v", event.Type, event.FileID, err)
+		}
+	}
+}
+
+func uploadEvent(fileID, userID int64, name string) *ReportEvent {
+	return &ReportEvent{
+		Type:      EventUpload,
+		Time:      time.Now(),
+		FileID:    fileID,
+		UserID:    userID,
+		FileName:  name,
+		CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// dataRows возвращает строки листа без заголовка
+func dataRows(t *testing.T, fake *sheetsfake.Server) [][]interface{} {
+	t.Helper()
+
+	rows := fake.Values(testSpreadsheet, "Лист1")
+	if len(rows) == 0 {
+		t.Fatal("sheet has no header")
+	}
+	return rows[1:]
+}
+
+// rowOf возвращает строку данных файла; номер ID в ячейке может быть числом или строкой
+func rowOf(t *testing.T, fake *sheetsfake.Server, fileID int64) []interface{} {
+	t.Helper()
+
+	for _, row := range dataRows(t, fake) {
+		if len(row) > 0 {
+			if id, ok := cellInt64(row[0]); ok && id == fileID {
+				return row
+			}
+		}
+	}
+	t.Fatalf("file %d not found in sheet", fileID)
+	return nil
+}
+
+func TestSheetsUploadAppendsOrUpdates(t *testing.T) {
+	tests := []struct {
+		name      string
+		batch     bool
+		events    []*ReportEvent
+		wantRows  int
+		wantNames map[int64]string
+	}{
+		{
+			name:      "new files are appended",
+			events:    []*ReportEvent{uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 10, "b.pdf")},
+			wantRows:  2,
+			wantNames: map[int64]string{1: "a.pdf", 2: "b.pdf"},
+		},
+		{
+			name:      "new files are appended in a batch",
+			batch:     true,
+			events:    []*ReportEvent{uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 10, "b.pdf")},
+			wantRows:  2,
+			wantNames: map[int64]string{1: "a.pdf", 2: "b.pdf"},
+		},
+		{
+			name:      "indexed file is updated in place",
+			events:    []*ReportEvent{uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 10, "b.pdf"), uploadEvent(1, 20, "a2.pdf")},
+			wantRows:  2,
+			wantNames: map[int64]string{1: "a2.pdf", 2: "b.pdf"},
+		},
+		{
+			name:      "indexed file is updated in place in a batch",
+			batch:     true,
+			events:    []*ReportEvent{uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 10, "b.pdf"), uploadEvent(1, 20, "a2.pdf")},
+			wantRows:  2,
+			wantNames: map[int64]string{1: "a2.pdf", 2: "b.pdf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake, database := newTestSheets(t)
+
+			// Повторная запись должна найти строку по индексу, поэтому пакет делится на два
+			first, rest := tt.events, []*ReportEvent(nil)
+			if len(tt.events) > 2 {
+				first, rest = tt.events[:2], tt.events[2:]
+			}
+			writeEvents(t, s, tt.batch, first...)
+			if len(rest) > 0 {
+				writeEvents(t, s, tt.batch, rest...)
+			}
+
+			if rows := dataRows(t, fake); len(rows) != tt.wantRows {
+				t.Fatalf("got %d rows, want %d: %v", len(rows), tt.wantRows, rows)
+			}
+			for fileID, name := range tt.wantNames {
+				if got := rowOf(t, fake, fileID)[2]; got != name {
+					t.Errorf("file %d: name %v, want %q", fileID, got, name)
+				}
+			}
+
+			// Индекс указывает на строки файлов и на их нынешних владельцев
+			last := tt.events[len(tt.events)-1]
+			row, err := database.GetSheetRow(last.FileID)
+			if err != nil || row == nil {
+				t.Fatalf("GetSheetRow(%d) = %v, %v", last.FileID, row, err)
+			}
+			if row.UserID != last.UserID {
+				t.Errorf("indexed owner %d, want %d", row.UserID, last.UserID)
+			}
+			if id, _ := cellInt64(fake.Values(testSpreadsheet, "Лист1")[row.Row-1][0]); id != last.FileID {
+				t.Errorf("indexed row %d holds file %d, want %d", row.Row, id, last.FileID)
+			}
+		})
+	}
+}
+
+func TestSheetsStaleIndexIsRebuilt(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		name := "single"
+		if batch {
+			name = "batch"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, fake, database := newTestSheets(t)
+			writeEvents(t, s, batch, uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 10, "b.pdf"))
+
+			// Первое изменение статуса строит индекс; дальше ему доверяют, пока проверка строк проходит
+			writeEvents(t, s, batch, &ReportEvent{Type: EventRestore, Time: time.Now(), FileID: 2, UserID: 10})
+			if row, err := database.GetSheetRow(1); err != nil || row == nil || row.Row != 2 {
+				t.Fatalf("GetSheetRow(1) = %+v, %v; want row 2", row, err)
+			}
+
+			// Кто-то вставил строку над данными и поменял файлы местами
+			header := fake.Values(testSpreadsheet, "Лист1")[0]
+			fake.SetValues(testSpreadsheet, "Лист1", [][]interface{}{
+				header,
+				{"", "", "заметка", ""},
+				{float64(2), float64(10), "b.pdf", FileStatusActive},
+				{float64(1), float64(10), "a.pdf", FileStatusActive},
+			})
+
+			writeEvents(t, s, batch, &ReportEvent{Type: EventDelete, Time: time.Now(), FileID: 1, UserID: 10})
+
+			if got := rowOf(t, fake, 1)[3]; got != FileStatusDeleted {
+				t.Errorf("file 1 status %v, want %q", got, FileStatusDeleted)
+			}
+			if got := rowOf(t, fake, 2)[3]; got != FileStatusActive {
+				t.Errorf("file 2 status %v, want %q", got, FileStatusActive)
+			}
+			if note := dataRows(t, fake)[0]; len(note) > 3 && note[3] != "" {
+				t.Errorf("status written to the note row: %v", note)
+			}
+
+			row, err := database.GetSheetRow(1)
+			if err != nil || row == nil || row.Row != 4 {
+				t.Errorf("GetSheetRow(1) = %+v, %v; want row 4", row, err)
+			}
+		})
+	}
+}
+
+func TestSheetsIDCells(t *testing.T) {
+	tests := []struct {
+		name   string
+		fileID interface{}
+		userID interface{}
+	}{
+		{"numbers", float64(7), float64(70)},
+		{"strings", "7", "70"},
+		{"mixed", "7", float64(70)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake, _ := newTestSheets(t)
+
+			// Строка записана вручную или старой версией бота и не попала в индекс
+			fake.SetValues(testSpreadsheet, "Лист1", [][]interface{}{
+				{"ID файла", "ID пользователя", "Имя файла", "Статус"},
+				{tt.fileID, tt.userID, "manual.pdf", FileStatusActive},
+			})
+
+			if err := s.UpdateFileStatus(7, FileStatusDeleted); err != nil {
+				t.Fatalf("UpdateFileStatus: %v", err)
+			}
+			if got := rowOf(t, fake, 7)[3]; got != FileStatusDeleted {
+				t.Errorf("status %v, want %q", got, FileStatusDeleted)
+			}
+
+			if err := s.MarkAllFilesAsDeleted(70); err != nil {
+				t.Fatalf("MarkAllFilesAsDeleted: %v", err)
+			}
+			rows, err := s.findUserRows(70)
+			if err != nil || len(rows) != 1 || rows[0].FileID != 7 {
+				t.Errorf("findUserRows(70) = %v, %v; want file 7", rows, err)
+			}
+		})
+	}
+}
+
+func TestMarkAllFilesAsDeleted(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      int64
+		wantDeleted []int64
+		wantActive  []int64
+	}{
+		{"user with files", 10, []int64{1, 3}, []int64{2}},
+		{"other user", 20, []int64{2}, []int64{1, 3}},
+		{"user without files", 30, nil, []int64{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake, _ := newTestSheets(t)
+			writeEvents(t, s, false, uploadEvent(1, 10, "a.pdf"), uploadEvent(2, 20, "b.pdf"), uploadEvent(3, 10, "c.pdf"))
+
+			if err := s.MarkAllFilesAsDeleted(tt.userID); err != nil {
+				t.Fatalf("MarkAllFilesAsDeleted: %v", err)
+			}
+
+			for _, fileID := range tt.wantDeleted {
+				if got := rowOf(t, fake, fileID)[3]; got != FileStatusDeleted {
+					t.Errorf("file %d status %v, want %q", fileID, got, FileStatusDeleted)
+				}
+			}
+			for _, fileID := range tt.wantActive {
+				if got := rowOf(t, fake, fileID)[3]; got != FileStatusActive {
+					t.Errorf("file %d status %v, want %q", fileID, got, FileStatusActive)
+				}
+			}
+		})
+	}
+}
+
+func TestSheetsFormulaValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		position string
+		want     interface{}
+	}{
+		{"plain text", "Инженер", "Инженер"},
+		{"formula", `=IMPORTXML("http://example.com", "//a")`, `'=IMPORTXML("http://example.com", "//a")`},
+		{"plus", "+7 900 123-45-67", "'+7 900 123-45-67"},
+		{"minus", "-5", "'-5"},
+		{"at", "@cmd", "'@cmd"},
+		{"sign inside", "a=b", "a=b"},
+		{"empty", "", ""},
+	}
+
+	s, _, _ := newTestSheets(t)
+	file := &models.File{ID: 1, UserID: 10}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{ID: 10, Position: tt.position}
+			if got := s.cellValue(config.SheetFieldPosition, file, user, ""); got != tt.want {
+				t.Errorf("cellValue = %q, want %q", got, tt.want)
+			}
+			// В таблице апостроф не виден, поэтому сверка видит исходное значение
+			if got := fieldValue(config.SheetFieldPosition, file, user, ""); got != tt.position {
+				t.Errorf("fieldValue = %q, want %q", got, tt.position)
+			}
+		})
+	}
+
+	// Без апострофа таблица прочитала бы такое имя как формулу или число
+	t.Run("written as text", func(t *testing.T) {
+		s, fake, _ := newTestSheets(t)
+		writeEvents(t, s, false, uploadEvent(1, 10, "=1+1"), uploadEvent(2, 10, "-5"))
+		for fileID, name := range map[int64]string{1: "=1+1", 2: "-5"} {
+			if got := rowOf(t, fake, fileID)[2]; got != name {
+				t.Errorf("file %d: name %#v, want %q", fileID, got, name)
+			}
+		}
+	})
+}
+
+func TestReconcileDuplicateRows(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []int64
+		rows       [][]interface{}
+		wantStatus []string
+	}{
+		{
+			name:  "stored file keeps the first row",
+			files: []int64{1, 2},
+			rows: [][]interface{}{
+				{float64(1), float64(10), "a.pdf", FileStatusActive},
+				{float64(2), float64(10), "b.pdf", FileStatusActive},
+				{float64(1), float64(10), "a.pdf", FileStatusActive},
+			},
+			wantStatus: []string{FileStatusActive, FileStatusActive, FileStatusDuplicate},
+		},
+		{
+			name:  "row marked as duplicate is not chosen",
+			files: []int64{1},
+			rows: [][]interface{}{
+				{float64(1), float64(10), "a.pdf", FileStatusDuplicate},
+				{float64(1), float64(10), "a.pdf", FileStatusDeleted},
+				{float64(1), float64(10), "old.pdf", FileStatusActive},
+			},
+			wantStatus: []string{FileStatusDuplicate, FileStatusActive, FileStatusDuplicate},
+		},
+		{
+			name: "file gone from the storage",
+			rows: [][]interface{}{
+				{float64(1), float64(10), "a.pdf", FileStatusActive},
+				{float64(1), float64(10), "a.pdf", FileStatusActive},
+			},
+			wantStatus: []string{FileStatusDeleted, FileStatusDuplicate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake, database := newTestSheets(t)
+			header := []interface{}{"ID файла", "ID пользователя", "Имя файла", "Статус"}
+			fake.SetValues(testSpreadsheet, "Лист1", append([][]interface{}{header}, tt.rows...))
+
+			var files []*models.File
+			for _, id := range tt.files {
+				files = append(files, &models.File{ID: id, UserID: 10, FileName: map[int64]string{1: "a.pdf", 2: "b.pdf"}[id]})
+			}
+
+			report, err := s.Reconcile(files, nil, nil, false)
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(report.Duplicates) != 1 || report.Duplicates[0] != 1 {
+				t.Errorf("Duplicates = %v, want [1]", report.Duplicates)
+			}
+			for i, row := range dataRows(t, fake) {
+				if row[3] != tt.wantStatus[i] {
+					t.Errorf("row %d: status %v, want %q", i+2, row[3], tt.wantStatus[i])
+				}
+			}
+
+			// Индекс указывает на основную строку
+			for i, status := range tt.wantStatus {
+				if status == FileStatusDuplicate {
+					continue
+				}
+				id, _ := cellInt64(tt.rows[i][0])
+				if id != 1 {
+					continue
+				}
+				if row, err := database.GetSheetRow(1); err != nil || row == nil || row.Row != i+2 {
+					t.Errorf("GetSheetRow(1) = %+v, %v; want row %d", row, err, i+2)
+				}
+			}
+
+			// Повторная сверка ничего не меняет
+			report, err = s.Reconcile(files, nil, nil, true)
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if !report.Empty() {
+				t.Errorf("second reconcile is not empty: %s", report)
+			}
+		})
+	}
+}
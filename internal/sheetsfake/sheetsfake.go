@@ -0,0 +1,633 @@
+// Package sheetsfake is an in-process fake of the Google Sheets v4 API.
+//
+// It keeps spreadsheets in memory and implements the calls used by the bot:
+// spreadsheets get and batchUpdate (addSheet), and values get, batchGet,
+// update, append, clear and batchUpdate. Point a SheetsService at it with
+// the Endpoint setting and a plain HTTP client:
+//
+//	fake := sheetsfake.NewServer()
+//	defer fake.Close()
+//	fake.AddSpreadsheet("test", "Лист1")
+//	cfg.SpreadsheetID, cfg.Endpoint = "test", fake.URL
+//	s, err := internal.NewSheetsServiceWithClient(cfg, database, http.DefaultClient)
+package sheetsfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a fake Sheets API server
+type Server struct {
+	// Base URL of the server, to be used as the API endpoint
+	URL string
+
+	server *httptest.Server
+
+	mu           sync.Mutex
+	spreadsheets map[string]*spreadsheet
+}
+
+type spreadsheet struct {
+	nextSheetID int64
+	sheets      []*sheet
+}
+
+type sheet struct {
+	id    int64
+	title string
+	cells [][]interface{}
+}
+
+// NewServer starts a fake server on a local port
+func NewServer() *Server {
+	s := &Server{spreadsheets: make(map[string]*spreadsheet)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL + "/"
+	return s
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddSpreadsheet creates an empty spreadsheet with the given sheets
+func (s *Server) AddSpreadsheet(id string, titles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := &spreadsheet{}
+	for _, title := range titles {
+		ss.addSheet(title)
+	}
+	s.spreadsheets[id] = ss
+}
+
+// SetValues replaces the contents of a sheet, creating the sheet if needed
+func (s *Server) SetValues(spreadsheetID, title string, rows [][]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := s.spreadsheets[spreadsheetID]
+	if ss == nil {
+		ss = &spreadsheet{}
+		s.spreadsheets[spreadsheetID] = ss
+	}
+	sh := ss.sheet(title)
+	if sh == nil {
+		sh = ss.addSheet(title)
+	}
+
+	sh.cells = make([][]interface{}, len(rows))
+	for i, row := range rows {
+		sh.cells[i] = append([]interface{}(nil), row...)
+	}
+}
+
+// Values returns a copy of the contents of a sheet, or nil if there is no such sheet
+func (s *Server) Values(spreadsheetID, title string) [][]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := s.spreadsheets[spreadsheetID]
+	if ss == nil {
+		return nil
+	}
+	sh := ss.sheet(title)
+	if sh == nil {
+		return nil
+	}
+
+	rows := make([][]interface{}, len(sh.cells))
+	for i, row := range sh.cells {
+		rows[i] = append([]interface{}(nil), row...)
+	}
+	return rows
+}
+
+// Sheets returns the titles of all sheets of a spreadsheet in order
+func (s *Server) Sheets(spreadsheetID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := s.spreadsheets[spreadsheetID]
+	if ss == nil {
+		return nil
+	}
+	titles := make([]string, len(ss.sheets))
+	for i, sh := range ss.sheets {
+		titles[i] = sh.title
+	}
+	return titles
+}
+
+func (ss *spreadsheet) addSheet(title string) *sheet {
+	sh := &sheet{id: ss.nextSheetID, title: title}
+	ss.nextSheetID++
+	ss.sheets = append(ss.sheets, sh)
+	return sh
+}
+
+func (ss *spreadsheet) sheet(title string) *sheet {
+	for _, sh := range ss.sheets {
+		if sh.title == title {
+			return sh
+		}
+	}
+	return nil
+}
+
+// apiError is written in the format of Google API errors
+type apiError struct {
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func errorf(code int, format string, args ...interface{}) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// serveHTTP routes requests of the form /v4/spreadsheets/{id}[/values/{range}][:method]
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// The escaped path is split first: sheet names may contain slashes
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			writeError(w, errorf(http.StatusBadRequest, "invalid path"))
+			return
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) < 3 || parts[0] != "v4" || parts[1] != "spreadsheets" {
+		writeError(w, errorf(http.StatusNotFound, "unknown path %s", r.URL.Path))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, method := splitMethod(parts[2])
+	ss := s.spreadsheets[id]
+	if ss == nil {
+		writeError(w, errorf(http.StatusNotFound, "Requested entity was not found."))
+		return
+	}
+
+	var resp interface{}
+	var err *apiError
+
+	switch {
+	case len(parts) == 3 && method == "" && r.Method == http.MethodGet:
+		resp = ss.get(id)
+	case len(parts) == 3 && method == "batchUpdate" && r.Method == http.MethodPost:
+		resp, err = ss.batchUpdate(id, r)
+	case len(parts) == 4 && parts[3] == "values:batchGet" && r.Method == http.MethodGet:
+		resp, err = ss.valuesBatchGet(id, r)
+	case len(parts) == 4 && parts[3] == "values:batchUpdate" && r.Method == http.MethodPost:
+		resp, err = ss.valuesBatchUpdate(id, r)
+	case len(parts) == 5 && parts[3] == "values":
+		a1, valuesMethod := splitMethod(parts[4])
+		switch {
+		case valuesMethod == "" && r.Method == http.MethodGet:
+			resp, err = ss.valuesGet(a1, r.URL.Query().Get("valueRenderOption"))
+		case valuesMethod == "" && r.Method == http.MethodPut:
+			resp, err = ss.valuesUpdate(id, a1, r)
+		case valuesMethod == "append" && r.Method == http.MethodPost:
+			resp, err = ss.valuesAppend(id, a1, r)
+		case valuesMethod == "clear" && r.Method == http.MethodPost:
+			resp, err = ss.valuesClear(id, a1)
+		default:
+			err = errorf(http.StatusNotFound, "unknown method %s %s", r.Method, r.URL.Path)
+		}
+	default:
+		err = errorf(http.StatusNotFound, "unknown method %s %s", r.Method, r.URL.Path)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// splitMethod splits "id:method" into the ID and the custom method name
+func splitMethod(segment string) (string, string) {
+	for _, method := range []string{"batchUpdate", "append", "clear"} {
+		if strings.HasSuffix(segment, ":"+method) {
+			return strings.TrimSuffix(segment, ":"+method), method
+		}
+	}
+	return segment, ""
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    err.code,
+			"message": err.message,
+			"status":  http.StatusText(err.code),
+		},
+	})
+}
+
+func (ss *spreadsheet) get(id string) interface{} {
+	sheets := make([]interface{}, len(ss.sheets))
+	for i, sh := range ss.sheets {
+		sheets[i] = map[string]interface{}{
+			"properties": map[string]interface{}{
+				"sheetId": sh.id,
+				"title":   sh.title,
+				"index":   i,
+			},
+		}
+	}
+	return map[string]interface{}{"spreadsheetId": id, "sheets": sheets}
+}
+
+// batchUpdate supports addSheet; formatting requests are accepted and ignored
+func (ss *spreadsheet) batchUpdate(id string, r *http.Request) (interface{}, *apiError) {
+	var req struct {
+		Requests []struct {
+			AddSheet *struct {
+				Properties struct {
+					Title string `json:"title"`
+				} `json:"properties"`
+			} `json:"addSheet"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+
+	replies := make([]interface{}, len(req.Requests))
+	for i, request := range req.Requests {
+		replies[i] = map[string]interface{}{}
+		if request.AddSheet == nil {
+			continue
+		}
+		title := request.AddSheet.Properties.Title
+		if ss.sheet(title) != nil {
+			return nil, errorf(http.StatusBadRequest, "A sheet with the name %q already exists.", title)
+		}
+		sh := ss.addSheet(title)
+		replies[i] = map[string]interface{}{
+			"addSheet": map[string]interface{}{
+				"properties": map[string]interface{}{"sheetId": sh.id, "title": sh.title},
+			},
+		}
+	}
+	return map[string]interface{}{"spreadsheetId": id, "replies": replies}, nil
+}
+
+func (ss *spreadsheet) valuesGet(a1, renderOption string) (interface{}, *apiError) {
+	rng, err := ss.parseRange(a1)
+	if err != nil {
+		return nil, err
+	}
+	return rng.read(renderOption), nil
+}
+
+func (ss *spreadsheet) valuesBatchGet(id string, r *http.Request) (interface{}, *apiError) {
+	query := r.URL.Query()
+	var valueRanges []interface{}
+	for _, a1 := range query["ranges"] {
+		rng, err := ss.parseRange(a1)
+		if err != nil {
+			return nil, err
+		}
+		valueRanges = append(valueRanges, rng.read(query.Get("valueRenderOption")))
+	}
+	return map[string]interface{}{"spreadsheetId": id, "valueRanges": valueRanges}, nil
+}
+
+type valueRange struct {
+	Range  string          `json:"range"`
+	Values [][]interface{} `json:"values"`
+}
+
+func (ss *spreadsheet) valuesUpdate(id, a1 string, r *http.Request) (interface{}, *apiError) {
+	var body valueRange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+	rng, err := ss.parseRange(a1)
+	if err != nil {
+		return nil, err
+	}
+	updated := rng.write(body.Values, r.URL.Query().Get("valueInputOption"))
+	return updateResponse(id, updated), nil
+}
+
+func (ss *spreadsheet) valuesBatchUpdate(id string, r *http.Request) (interface{}, *apiError) {
+	var body struct {
+		ValueInputOption string        `json:"valueInputOption"`
+		Data             []*valueRange `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+
+	// All ranges are checked before anything is written, as the real API does
+	ranges := make([]*cellRange, len(body.Data))
+	for i, data := range body.Data {
+		rng, err := ss.parseRange(data.Range)
+		if err != nil {
+			return nil, err
+		}
+		ranges[i] = rng
+	}
+
+	responses := make([]interface{}, len(ranges))
+	for i, rng := range ranges {
+		responses[i] = updateResponse(id, rng.write(body.Data[i].Values, body.ValueInputOption))
+	}
+	return map[string]interface{}{"spreadsheetId": id, "responses": responses}, nil
+}
+
+// valuesAppend writes the rows after the last non-empty row of the sheet
+func (ss *spreadsheet) valuesAppend(id, a1 string, r *http.Request) (interface{}, *apiError) {
+	var body valueRange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+	rng, err := ss.parseRange(a1)
+	if err != nil {
+		return nil, err
+	}
+
+	last := len(rng.sheet.cells)
+	for last > 0 && isEmptyRow(rng.sheet.cells[last-1]) {
+		last--
+	}
+	start := last
+	if start < rng.startRow {
+		start = rng.startRow
+	}
+
+	target := &cellRange{sheet: rng.sheet, startRow: start, endRow: -1, startCol: rng.startCol, endCol: -1}
+	updated := target.write(body.Values, r.URL.Query().Get("valueInputOption"))
+	return map[string]interface{}{
+		"spreadsheetId": id,
+		"updates":       updateResponse(id, updated),
+	}, nil
+}
+
+func (ss *spreadsheet) valuesClear(id, a1 string) (interface{}, *apiError) {
+	rng, err := ss.parseRange(a1)
+	if err != nil {
+		return nil, err
+	}
+	for row := rng.startRow; row < len(rng.sheet.cells) && (rng.endRow < 0 || row <= rng.endRow); row++ {
+		cells := rng.sheet.cells[row]
+		for col := rng.startCol; col < len(cells) && (rng.endCol < 0 || col <= rng.endCol); col++ {
+			cells[col] = nil
+		}
+	}
+	return map[string]interface{}{"spreadsheetId": id, "clearedRange": a1}, nil
+}
+
+// updated describes the cells touched by a write
+type updated struct {
+	rng     string
+	rows    int
+	columns int
+	cells   int
+}
+
+func updateResponse(id string, u updated) interface{} {
+	return map[string]interface{}{
+		"spreadsheetId":  id,
+		"updatedRange":   u.rng,
+		"updatedRows":    u.rows,
+		"updatedColumns": u.columns,
+		"updatedCells":   u.cells,
+	}
+}
+
+// cellRange is a parsed A1 range; rows and columns are zero-based and inclusive, -1 means unbounded
+type cellRange struct {
+	sheet    *sheet
+	startRow int
+	endRow   int
+	startCol int
+	endCol   int
+}
+
+// read returns the values of the range with trailing empty rows and cells removed
+func (rng *cellRange) read(renderOption string) *valueRange {
+	var values [][]interface{}
+	for row := rng.startRow; row < len(rng.sheet.cells) && (rng.endRow < 0 || row <= rng.endRow); row++ {
+		cells := rng.sheet.cells[row]
+		var out []interface{}
+		for col := rng.startCol; col < len(cells) && (rng.endCol < 0 || col <= rng.endCol); col++ {
+			out = append(out, render(cells[col], renderOption))
+		}
+		for len(out) > 0 && isEmpty(out[len(out)-1]) {
+			out = out[:len(out)-1]
+		}
+		values = append(values, out)
+	}
+	for len(values) > 0 && len(values[len(values)-1]) == 0 {
+		values = values[:len(values)-1]
+	}
+
+	return &valueRange{
+		Range:  formatRange(rng.sheet.title, rng.startRow, rng.startCol, rng.endRow, rng.endCol),
+		Values: values,
+	}
+}
+
+// write stores the values starting at the top left cell of the range
+func (rng *cellRange) write(values [][]interface{}, inputOption string) updated {
+	columns, cells := 0, 0
+	for i, row := range values {
+		rowIndex := rng.startRow + i
+		for len(rng.sheet.cells) <= rowIndex {
+			rng.sheet.cells = append(rng.sheet.cells, nil)
+		}
+		for j, value := range row {
+			colIndex := rng.startCol + j
+			for len(rng.sheet.cells[rowIndex]) <= colIndex {
+				rng.sheet.cells[rowIndex] = append(rng.sheet.cells[rowIndex], nil)
+			}
+			rng.sheet.cells[rowIndex][colIndex] = parseInput(value, inputOption)
+			cells++
+		}
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	return updated{
+		rng:     formatRange(rng.sheet.title, rng.startRow, rng.startCol, rng.startRow+len(values)-1, rng.startCol+columns-1),
+		rows:    len(values),
+		columns: columns,
+		cells:   cells,
+	}
+}
+
+// parseInput converts a written value the way Sheets does: with USER_ENTERED,
+// strings that look like numbers become numbers, and a leading apostrophe keeps
+// the rest of the string as text
+func parseInput(value interface{}, inputOption string) interface{} {
+	if inputOption != "USER_ENTERED" {
+		return value
+	}
+	if s, ok := value.(string); ok {
+		if strings.HasPrefix(s, "'") {
+			return s[1:]
+		}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// render returns a cell value as the API does: formatted values are strings
+func render(value interface{}, renderOption string) interface{} {
+	if value == nil {
+		return ""
+	}
+	if renderOption == "UNFORMATTED_VALUE" {
+		return value
+	}
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return fmt.Sprint(value)
+}
+
+func isEmpty(value interface{}) bool {
+	return value == nil || value == ""
+}
+
+func isEmptyRow(row []interface{}) bool {
+	for _, value := range row {
+		if !isEmpty(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRange parses ranges such as 'Лист1'!A2:H1001, Лист1!C5, 'Лист1'!A:ZZ or a bare sheet name
+func (ss *spreadsheet) parseRange(a1 string) (*cellRange, *apiError) {
+	title, cells := a1, ""
+	if i := strings.LastIndex(a1, "!"); i >= 0 {
+		title, cells = a1[:i], a1[i+1:]
+	}
+	if strings.HasPrefix(title, "'") && strings.HasSuffix(title, "'") && len(title) >= 2 {
+		title = strings.ReplaceAll(title[1:len(title)-1], "''", "'")
+	}
+
+	sh := ss.sheet(title)
+	if sh == nil {
+		return nil, errorf(http.StatusBadRequest, "Unable to parse range: %s", a1)
+	}
+
+	rng := &cellRange{sheet: sh, endRow: -1, endCol: -1}
+	if cells == "" {
+		return rng, nil
+	}
+
+	start, end, hasEnd := strings.Cut(cells, ":")
+	startCol, startRow, ok := parseCell(start)
+	if !ok {
+		return nil, errorf(http.StatusBadRequest, "Unable to parse range: %s", a1)
+	}
+	rng.startCol, rng.startRow = max(startCol, 0), max(startRow, 0)
+
+	if !hasEnd {
+		// A single cell
+		rng.endCol, rng.endRow = startCol, startRow
+		return rng, nil
+	}
+	endCol, endRow, ok := parseCell(end)
+	if !ok {
+		return nil, errorf(http.StatusBadRequest, "Unable to parse range: %s", a1)
+	}
+	rng.endCol, rng.endRow = endCol, endRow
+	return rng, nil
+}
+
+// parseCell parses a cell reference such as C5, C or 5 into zero-based indexes; -1 marks a missing part
+func parseCell(ref string) (int, int, bool) {
+	i := 0
+	col := -1
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		if col < 0 {
+			col = 0
+		}
+		col = col*26 + int(ref[i]-'A'+1)
+		i++
+	}
+	if col > 0 {
+		col--
+	}
+
+	row := -1
+	if i < len(ref) {
+		n, err := strconv.Atoi(ref[i:])
+		if err != nil || n < 1 {
+			return 0, 0, false
+		}
+		row = n - 1
+	}
+	if col < 0 && row < 0 {
+		return 0, 0, false
+	}
+	return col, row, true
+}
+
+// formatRange formats zero-based bounds as an A1 range; negative bounds are left out
+func formatRange(title string, startRow, startCol, endRow, endCol int) string {
+	cell := func(row, col int) string {
+		ref := ""
+		if col >= 0 {
+			ref = columnLetter(col)
+		}
+		if row >= 0 {
+			ref += strconv.Itoa(row + 1)
+		}
+		return ref
+	}
+
+	quoted := "'" + strings.ReplaceAll(title, "'", "''") + "'"
+	start, end := cell(startRow, startCol), cell(endRow, endCol)
+	if end == "" || end == start {
+		return quoted + "!" + start
+	}
+	return quoted + "!" + start + ":" + end
+}
+
+// columnLetter converts a zero-based column index to letters: 0 -> A, 26 -> AA
+func columnLetter(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
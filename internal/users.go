@@ -0,0 +1,368 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telegram-bot/db"
+	"telegram-bot/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Users shown on one page of /users
+const usersPageSize = 20
+
+// bannedText is the reply to banned and offboarded users
+const bannedText = "Доступ к боту заблокирован администратором."
+
+// requireManageUsers reports whether the sender may manage users and tells them if not
+func (b *Bot) requireManageUsers(message *tgbotapi.Message) bool {
+	a, err := b.accessFor(message.From.ID)
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при проверке прав доступа."))
+		return false
+	}
+	if !a.can(models.PermissionManageUsers) {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Эта команда доступна только пользователям с правом управления пользователями."))
+		return false
+	}
+	return true
+}
+
+// checkOutranks returns why the actor may not ban, unban or offboard the user, or "" if they may
+func (b *Bot) checkOutranks(actorID int64, user *models.User) string {
+	ok := false
+	a, err := b.accessFor(actorID)
+	if err == nil {
+		ok, err = a.outranks(user)
+	}
+	if err != nil {
+		log.Printf("Error checking access: %v", err)
+		return "Ошибка при проверке прав доступа."
+	}
+	if !ok {
+		return "Нельзя управлять пользователем, у которого есть права, которых нет у вас."
+	}
+	return ""
+}
+
+// handleUsersCommand lists registered users page by page: /users [page] [filters].
+// Filters: admins, banned, inactive, offboarded, role:<role>, dept:<department>; any other word searches names.
+func (b *Bot) handleUsersCommand(message *tgbotapi.Message) {
+	if !b.requireManageUsers(message) {
+		return
+	}
+
+	page := 1
+	var filter db.UserFilter
+	var filterArgs, search []string
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			page = n
+			continue
+		}
+		filterArgs = append(filterArgs, arg)
+
+		switch {
+		case arg == "admins":
+			filter.AdminsOnly = true
+		case arg == "banned":
+			filter.BannedOnly = true
+		case arg == "inactive":
+			filter.InactiveOnly = true
+		case arg == "offboarded":
+			filter.OffboardedOnly = true
+		case strings.HasPrefix(arg, "role:"):
+			filter.Role = strings.TrimPrefix(arg, "role:")
+		case strings.HasPrefix(arg, "dept:"):
+			name := strings.TrimPrefix(arg, "dept:")
+			department, err := b.DB.GetDepartmentByName(name)
+			if err != nil {
+				log.Printf("Error getting department: %v", err)
+			}
+			if department == nil {
+				b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Отдел «%s» не найден.", name)))
+				return
+			}
+			filter.DepartmentID = department.ID
+		default:
+			search = append(search, strings.TrimPrefix(arg, "@"))
+		}
+	}
+	filter.Search = strings.Join(search, " ")
+
+	users, total, err := b.DB.ListUsers(filter, (page-1)*usersPageSize, usersPageSize)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении списка пользователей."))
+		return
+	}
+	if total == 0 {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Пользователи не найдены."))
+		return
+	}
+
+	pages := (total + usersPageSize - 1) / usersPageSize
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("Пользователи: %d, страница %d из %d\n\n", total, page, pages))
+	for i, user := range users {
+		var marks []string
+		if user.IsAdmin {
+			marks = append(marks, "админ")
+		}
+		if user.Banned {
+			marks = append(marks, "заблокирован")
+		}
+		if user.Offboarded {
+			marks = append(marks, "уволен")
+		}
+		if !user.IsActive {
+			marks = append(marks, "неактивен")
+		}
+		line := fmt.Sprintf("%d. %s (ID: %d), %s", (page-1)*usersPageSize+i+1, displayName(user), user.ID, user.Role)
+		if len(marks) > 0 {
+			line += ", " + strings.Join(marks, ", ")
+		}
+		response.WriteString(line + "\n")
+	}
+	if page < pages {
+		next := append([]string{"/users", strconv.Itoa(page + 1)}, filterArgs...)
+		response.WriteString("\nСледующая страница: " + strings.Join(next, " "))
+	}
+	response.WriteString("\nКарточка пользователя: /user <ID или @username>")
+
+	b.sendText(message.Chat.ID, response.String())
+}
+
+// handleUserCommand shows a user card: /user <ID or @username>
+func (b *Bot) handleUserCommand(message *tgbotapi.Message) {
+	if !b.requireManageUsers(message) {
+		return
+	}
+
+	user := b.commandTarget(message, "/user @username")
+	if user == nil {
+		return
+	}
+
+	card, err := b.userCard(user)
+	if err != nil {
+		log.Printf("Error building user card: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при получении данных пользователя."))
+		return
+	}
+	b.sendText(message.Chat.ID, card)
+}
+
+// userCard describes a user for admins
+func (b *Bot) userCard(user *models.User) (string, error) {
+	var card strings.Builder
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.Username != "" {
+		name += " @" + user.Username
+	}
+	card.WriteString(fmt.Sprintf("👤 %s\nID: %d\n", strings.TrimSpace(name), user.ID))
+
+	phone := user.Phone
+	if phone == "" {
+		phone = "не указан"
+	}
+	card.WriteString(fmt.Sprintf("Телефон: %s\n", phone))
+
+	roleName := user.Role
+	if role, err := b.DB.GetRole(user.Role); err != nil {
+		return "", err
+	} else if role != nil {
+		roleName = role.Title
+	}
+	if user.IsAdmin {
+		roleName += ", администратор"
+	}
+	card.WriteString(fmt.Sprintf("Роль: %s\n", roleName))
+
+	if user.Department != "" {
+		card.WriteString(fmt.Sprintf("Отдел: %s\n", user.Department))
+	}
+	if user.Position != "" {
+		card.WriteString(fmt.Sprintf("Должность: %s\n", user.Position))
+	}
+	if user.EmployeeID != "" {
+		card.WriteString(fmt.Sprintf("Табельный номер: %s\n", user.EmployeeID))
+	}
+	if user.Email != "" {
+		card.WriteString(fmt.Sprintf("Email: %s\n", user.Email))
+	}
+	if !user.HireDate.IsZero() {
+		card.WriteString(fmt.Sprintf("Дата приема: %s\n", user.HireDate.Format(profileDateLayout)))
+	}
+	if user.ManagerID != 0 {
+		manager, err := b.DB.GetUser(user.ManagerID)
+		if err != nil {
+			return "", err
+		}
+		if manager != nil {
+			card.WriteString(fmt.Sprintf("Руководитель: %s\n", displayName(manager)))
+		}
+	}
+
+	status := "активен"
+	switch {
+	case user.Offboarded:
+		status = "уволен"
+	case user.Banned:
+		status = "заблокирован"
+	case !user.Approved:
+		status = "ожидает подтверждения"
+	case !user.IsActive:
+		status = "заблокировал бота"
+	}
+	card.WriteString(fmt.Sprintf("Статус: %s\n", status))
+	if !user.CreatedAt.IsZero() {
+		card.WriteString(fmt.Sprintf("Зарегистрирован: %s\n", user.CreatedAt.Local().Format("02.01.2006 15:04")))
+	}
+	if !user.LastSeen.IsZero() {
+		card.WriteString(fmt.Sprintf("Последняя активность: %s\n", user.LastSeen.Local().Format("02.01.2006 15:04")))
+	}
+
+	stats, err := b.DB.GetUserFileStats(user.ID)
+	if err != nil {
+		return "", err
+	}
+	card.WriteString(fmt.Sprintf("Файлов: %d, объем: %s\n", stats.Count, humanSize(stats.Size)))
+	if !stats.LastUpload.IsZero() {
+		card.WriteString(fmt.Sprintf("Последняя загрузка: %s\n", stats.LastUpload.Local().Format("02.01.2006 15:04")))
+	}
+	return card.String(), nil
+}
+
+// handleBanCommand blocks a user: /ban <ID or @username> [archive].
+// With "archive" the user's files are handed over to the archive owner from the config.
+func (b *Bot) handleBanCommand(message *tgbotapi.Message) {
+	if !b.requireManageUsers(message) {
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	archive := len(args) > 1 && args[len(args)-1] == "archive"
+	if archive && b.Config.ArchiveUserID == 0 {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Архивный владелец не задан: укажите archive_user_id в конфигурации."))
+		return
+	}
+
+	user := b.commandTarget(message, "/ban @username [archive]")
+	if user == nil {
+		return
+	}
+	if user.ID == message.From.ID || user.IsAdmin {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Нельзя заблокировать себя или администратора."))
+		return
+	}
+	if text := b.checkOutranks(message.From.ID, user); text != "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+	if user.Banned {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("%s уже заблокирован.", displayName(user))))
+		return
+	}
+
+	if err := b.DB.SetUserBanned(user.ID, true); err != nil {
+		log.Printf("Error banning user: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при блокировке пользователя."))
+		return
+	}
+	b.endDialog(user.ID)
+	b.audit(message.From.ID, models.AuditBan, user.ID, displayName(user))
+
+	text := fmt.Sprintf("🚫 %s заблокирован.", displayName(user))
+	if archive {
+		moved, err := b.handoverFiles(message.From.ID, user, b.Config.ArchiveUserID)
+		if err != nil {
+			log.Printf("Error handing over files: %v", err)
+			text += "\nОшибка при передаче файлов в архив."
+		} else {
+			text += fmt.Sprintf("\nФайлов передано в архив: %d.", moved)
+		}
+	}
+	b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// handleUnbanCommand unblocks a user: /unban <ID or @username>
+func (b *Bot) handleUnbanCommand(message *tgbotapi.Message) {
+	if !b.requireManageUsers(message) {
+		return
+	}
+
+	user := b.commandTarget(message, "/unban @username")
+	if user == nil {
+		return
+	}
+	if text := b.checkOutranks(message.From.ID, user); text != "" {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+	if !user.Banned {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("%s не заблокирован.", displayName(user))))
+		return
+	}
+
+	if err := b.DB.SetUserBanned(user.ID, false); err != nil {
+		log.Printf("Error unbanning user: %v", err)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Ошибка при разблокировке пользователя."))
+		return
+	}
+	b.audit(message.From.ID, models.AuditUnban, user.ID, displayName(user))
+
+	b.send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ %s разблокирован.", displayName(user))))
+}
+
+// commandTarget finds the user named in the first command argument.
+// If there is none, the user is told how to use the command and nil is returned.
+func (b *Bot) commandTarget(message *tgbotapi.Message, usage string) *models.User {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Укажите пользователя. Например: "+usage))
+		return nil
+	}
+
+	user, err := b.findUser(args[0])
+	if err != nil {
+		b.sendLookupError(message.Chat.ID, err)
+		return nil
+	}
+	if user == nil {
+		b.send(tgbotapi.NewMessage(message.Chat.ID, "Пользователь не найден."))
+	}
+	return user
+}
+
+// handoverFiles moves all files of a user to another owner and reports the change
+func (b *Bot) handoverFiles(actorID int64, from *models.User, toUserID int64) (int, error) {
+	files, err := b.DB.ReassignUserFiles(from.ID, toUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	owner := fmt.Sprint(toUserID)
+	if user, err := b.DB.GetUser(toUserID); err == nil && user != nil {
+		owner = displayName(user)
+	}
+	for _, file := range files {
+		b.report(fileEvent(EventReassign, file, owner))
+	}
+
+	b.audit(actorID, models.AuditHandover, from.ID, fmt.Sprintf("%d файлов → %s", len(files), owner))
+	return len(files), nil
+}
+
+// audit records an administrative action, logging failures
+func (b *Bot) audit(actorID int64, action string, targetID int64, details string) {
+	entry := &models.AuditEntry{ActorID: actorID, Action: action, TargetID: targetID, Details: details}
+	if err := b.DB.AddAuditEntry(entry); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+	log.Printf("Audit: user %d %s user %d: %s", actorID, action, targetID, details)
+}
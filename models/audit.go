@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEntry records an administrative action
+type AuditEntry struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	ActorID  int64     `json:"actor_id"`
+	Action   string    `json:"action"`
+	TargetID int64     `json:"target_id"`
+	Details  string    `json:"details"`
+}
+
+// Audited actions
+const (
+	AuditPromote  = "promote"
+	AuditDemote   = "demote"
+	AuditBan      = "ban"
+	AuditUnban    = "unban"
+	AuditHandover = "handover"
+	AuditOffboard = "offboard"
+	AuditErase    = "erase"
+)
@@ -0,0 +1,7 @@
+package models
+
+// Department is a unit of the organization that users belong to
+type Department struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
@@ -8,8 +8,16 @@ import (
 type File struct {
 	ID        int64     `bson:"_id"`
 	UserID    int64     `bson:"user_id"`
+	ChatID    int64     `bson:"chat_id,omitempty"`
+	Team      string    `bson:"team,omitempty"`
 	FileName  string    `bson:"file_name"`
 	FileType  string    `bson:"file_type"`
 	FileData  []byte    `bson:"file_data"`
+	Size      int64     `bson:"size"`
 	CreatedAt time.Time `bson:"created_at"`
+
+	// Manager review from the spreadsheet
+	Review        string    `bson:"review,omitempty"`
+	ReviewComment string    `bson:"review_comment,omitempty"`
+	ReviewedAt    time.Time `bson:"reviewed_at,omitempty"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Group represents a group chat registered as a team channel
+type Group struct {
+	ChatID       int64     `json:"chat_id"`
+	Title        string    `json:"title"`
+	Type         string    `json:"type"`
+	RegisteredBy int64     `json:"registered_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
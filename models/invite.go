@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Invite is a one-time code that lets a new user register
+type Invite struct {
+	Code      string    `json:"code"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedBy    int64     `json:"used_by"`
+	UsedAt    time.Time `json:"used_at"`
+}
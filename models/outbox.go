@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxEntry is a pending write to an external service, kept until it succeeds
+type OutboxEntry struct {
+	ID            int64     `json:"id"`
+	Sink          string    `json:"sink"`
+	Kind          string    `json:"kind"`
+	FileID        int64     `json:"file_id"`
+	UserID        int64     `json:"user_id"`
+	Payload       string    `json:"payload"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// When the entry ran out of attempts; zero while it is still retried
+	FailedAt time.Time `json:"failed_at"`
+}
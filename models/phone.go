@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// PhoneChange records a change of a user's phone number
+type PhoneChange struct {
+	OldPhone  string    `json:"old_phone"`
+	NewPhone  string    `json:"new_phone"`
+	ChangedAt time.Time `json:"changed_at"`
+}
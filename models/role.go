@@ -0,0 +1,56 @@
+package models
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Permissions []string `json:"permissions"`
+}
+
+// Permissions that roles can grant
+const (
+	PermissionViewOwn     = "view_own"
+	PermissionViewTeam    = "view_team"
+	PermissionViewAll     = "view_all"
+	PermissionDeleteAny   = "delete_any"
+	PermissionManageUsers = "manage_users"
+	PermissionExport      = "export"
+)
+
+// Built-in roles
+const (
+	RoleEmployee   = "employee"
+	RoleTeamLead   = "team_lead"
+	RoleHR         = "hr"
+	RoleAuditor    = "auditor"
+	RoleSuperadmin = "superadmin"
+)
+
+// AllPermissions lists every permission, in the order they are shown to users
+var AllPermissions = []string{
+	PermissionViewOwn,
+	PermissionViewTeam,
+	PermissionViewAll,
+	PermissionDeleteAny,
+	PermissionManageUsers,
+	PermissionExport,
+}
+
+// DefaultRoles are created on first start; their permissions can be changed in the roles table
+var DefaultRoles = []*Role{
+	{Name: RoleEmployee, Title: "Сотрудник", Permissions: []string{PermissionViewOwn}},
+	{Name: RoleTeamLead, Title: "Руководитель группы", Permissions: []string{PermissionViewOwn, PermissionViewTeam}},
+	{Name: RoleHR, Title: "HR", Permissions: []string{PermissionViewOwn, PermissionViewAll, PermissionManageUsers}},
+	{Name: RoleAuditor, Title: "Аудитор", Permissions: []string{PermissionViewOwn, PermissionViewAll, PermissionExport}},
+	{Name: RoleSuperadmin, Title: "Суперадминистратор", Permissions: AllPermissions},
+}
+
+// Has reports whether the role grants the permission
+func (r *Role) Has(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+package models
+
+// SheetRow records which spreadsheet row holds the record of a file
+type SheetRow struct {
+	FileID    int64  `json:"file_id"`
+	UserID    int64  `json:"user_id"`
+	SheetName string `json:"sheet_name"`
+	Row       int    `json:"row"`
+}
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 // User represents a Telegram bot user
 type User struct {
 	ID        int64  `json:"id"`
@@ -8,4 +12,46 @@ type User struct {
 	LastName  string `json:"last_name"`
 	Phone     string `json:"phone"`
 	IsAdmin   bool   `json:"is_admin"`
+	IsActive  bool   `json:"is_active"`
+
+	// Name of the role that grants the user's permissions
+	Role string `json:"role"`
+
+	// Whether the user passed the whitelist or invite check; users registered
+	// before registration was restricted are approved
+	Approved bool `json:"approved"`
+
+	// Employee ID the user registered with, if any
+	EmployeeID string `json:"employee_id"`
+
+	// Blocked by an admin; banned users cannot use the bot
+	Banned bool `json:"banned"`
+
+	// Left the company; the account is deactivated for good
+	Offboarded bool `json:"offboarded"`
+
+	// Department and direct manager; zero when not set
+	DepartmentID int64 `json:"department_id"`
+	ManagerID    int64 `json:"manager_id"`
+
+	// Name of the department, read together with the user
+	Department string `json:"department,omitempty"`
+
+	// The department and manager come from an org import and are not edited in the profile
+	OrgImported bool `json:"org_imported"`
+
+	// Profile filled in by the employee with /profile; HireDate is zero when not set
+	Position string    `json:"position"`
+	Email    string    `json:"email"`
+	HireDate time.Time `json:"hire_date"`
+
+	// When the user registered and last wrote to the bot; zero for users
+	// registered before these were recorded
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Blocked reports whether the user may no longer use the bot
+func (u *User) Blocked() bool {
+	return u.Banned || u.Offboarded
 }